@@ -33,6 +33,11 @@ dhcpd_leases.parse = function(file_path)
   file_path = file_path or "/var/db/dhcpd_leases"
   local leases = {}
 
+  -- expire the cache of the evaluated config when the file is modified
+  if xs and xs.cache_dependency then
+    xs.cache_dependency(file_path)
+  end
+
   -- open file
   local file = io.open(file_path, "r")
   if not file then
@@ -20,18 +20,18 @@ local sshrc = function(override_config)
 
     local ret = shell.run([=[
 function gen_sshrc_data() {
-  local sshhome="]=] .. config.sshhome .. [=["
+  local sshhome=]=] .. shell.quote(config.sshhome) .. [=[
   if [ -f "$sshhome/.sshrc" ]; then
     local files=".sshrc"
-    if [ -d $sshhome/.sshrc.d ]; then
+    if [ -d "$sshhome/.sshrc.d" ]; then
       files="$files .sshrc.d"
     fi
-    local total_file_size=$(tar cz -h -C $sshhome $files | wc -c)
+    local total_file_size=$(tar cz -h -C "$sshhome" $files | wc -c)
     if [ $total_files_size -gt 65536 ]; then
       echo >&2 $'.sshrc.d and .sshrc files must be less than 64kb\ncurrent size: '$total_file_size' bytes'
       exit 1
     fi
-    echo $(tar cz -h -C $sshhome $files | openssl enc -base64)
+    echo $(tar cz -h -C "$sshhome" $files | openssl enc -base64)
   else
     echo "No such file: $sshhome/.sshrc" >&2
     exit 1
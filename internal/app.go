@@ -25,8 +25,21 @@ func newApp() *cli.Command {
 
 	app.Commands = []*cli.Command{
 		SSHConfigCommand,
+		CheckCommand,
 		ListCommand,
+		ShowCommand,
+		ImportCommand,
+		CacheCommand,
+		TunnelCommand,
+		MuxCommand,
+		ExecCommand,
+		PickCommand,
+		ScpCommand,
+		SftpCommand,
+		RsyncCommand,
 		ZshCompletionCommand,
+		BashCompletionCommand,
+		FishCompletionCommand,
 		XscpFunctionCommand,
 	}
 	app.Before = func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
@@ -39,6 +52,10 @@ func newApp() *cli.Command {
 			if first == "help" || first == "--help" || first == "-h" {
 				return cli.ShowAppHelp(cmd)
 			}
+			if first == "-" {
+				// "xs -" is a shortcut for "xs pick"
+				return pickAndRun(ctx, cmd, cmd.Args().Tail())
+			}
 			// if args are present, run the ssh command
 			return runAction(ctx, cmd)
 		}
@@ -0,0 +1,87 @@
+# This is a bash completion script for xs
+# If you want to use this script, add the following line to your .bashrc
+# ----------------------------------
+# eval "$(xs bash-completion)"
+# ----------------------------------
+
+_xs_hosts() {
+  {{ .Executable }} bash-completion --hosts 2>/dev/null | cut -f1
+}
+
+_xs() {
+  local cur prev i word destination_index=0
+  local builtin_commands="{{ range .Commands }}{{ .Name }} {{ end }}"
+  local ssh_options="-4 -6 -A -a -B -b -C -c -D -E -e -F -f -G -g -I -i -J -K -k -L -l -M -m -N -n -O -o -p -Q -q -R -S -s -T -t -V -v -W -w -X -x -Y -y -h"
+
+  COMPREPLY=()
+  cur="${COMP_WORDS[COMP_CWORD]}"
+  prev="${COMP_WORDS[COMP_CWORD-1]}"
+
+  # complete the values of ssh options
+  case "$prev" in
+    -E|-F|-I|-i|-S)
+      COMPREPLY=($(compgen -f -- "$cur"))
+      return 0
+      ;;
+    -J)
+      COMPREPLY=($(compgen -W "$(_xs_hosts)" -- "$cur"))
+      return 0
+      ;;
+    -O)
+      COMPREPLY=($(compgen -W "check forward cancel exit stop proxy" -- "$cur"))
+      return 0
+      ;;
+    -B|-b|-c|-D|-e|-L|-l|-m|-o|-p|-Q|-R|-W|-w)
+      return 0
+      ;;
+  esac
+
+  # find the builtin command or destination
+  for ((i = 1; i < COMP_CWORD; i++)); do
+    word="${COMP_WORDS[i]}"
+    case "$word" in
+      -B|-b|-c|-D|-E|-e|-F|-I|-i|-J|-L|-l|-m|-O|-o|-p|-Q|-R|-S|-W|-w)
+        ((i++))
+        ;;
+      -*)
+        ;;
+      *)
+        destination_index=$i
+        break
+        ;;
+    esac
+  done
+
+  if [[ $destination_index -eq 0 ]]; then
+    if [[ "$cur" == -* ]]; then
+      COMPREPLY=($(compgen -W "$ssh_options" -- "$cur"))
+    else
+      COMPREPLY=($(compgen -W "$(_xs_hosts) $builtin_commands" -- "$cur"))
+    fi
+    return 0
+  fi
+
+  case "${COMP_WORDS[destination_index]}" in
+    exec)
+      if [[ $((COMP_CWORD - destination_index)) -eq 1 && "$cur" != -* ]]; then
+        COMPREPLY=($(compgen -W "$(_xs_hosts)" -- "$cur"))
+        return 0
+      fi
+      ;;
+    scp|rsync)
+      if [[ "$cur" != -* && "$cur" != */* && "$cur" != *:* ]]; then
+        COMPREPLY=($(compgen -W "$(_xs_hosts | sed 's/$/:/')" -- "$cur"))
+        compopt -o nospace 2>/dev/null
+      fi
+      ;;
+    sftp)
+      if [[ "$cur" != -* ]]; then
+        COMPREPLY=($(compgen -W "$(_xs_hosts)" -- "$cur"))
+        return 0
+      fi
+      ;;
+  esac
+  return 0
+}
+
+complete -o default -F _xs xs
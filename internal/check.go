@@ -0,0 +1,275 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/yuin/gopher-lua"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hostParameters is the list of the parameters that a host and a host template accept.
+var hostParameters = []string{
+	"name",
+	"description",
+	"hidden",
+	"match",
+	"tags",
+	"extends",
+	"ssh_config",
+	"on_before_connect",
+	"on_after_connect",
+	"on_after_disconnect",
+	"on_before_command",
+	"on_after_command",
+	"tunnels",
+}
+
+// ConfigIssue is a problem in the config found while loading it.
+// The issues don't prevent XS from working, but they are likely mistakes. "xs check" reports them.
+type ConfigIssue struct {
+	// Pos is the position in the Lua source like "/path/to/config.lua:10".
+	Pos     string
+	Message string
+}
+
+func (i *ConfigIssue) String() string {
+	if i.Pos == "" {
+		return i.Message
+	}
+	return i.Pos + ": " + i.Message
+}
+
+// sortConfigIssues sorts the issues by the positions and the messages.
+// The order of the issues found while loading is not stable because Lua tables are iterated in random order.
+func sortConfigIssues(issues []*ConfigIssue) {
+	split := func(pos string) (string, int) {
+		i := strings.LastIndex(pos, ":")
+		if i < 0 {
+			return pos, 0
+		}
+		line, _ := strconv.Atoi(pos[i+1:])
+		return pos[:i], line
+	}
+	sort.SliceStable(issues, func(i, j int) bool {
+		fi, li := split(issues[i].Pos)
+		fj, lj := split(issues[j].Pos)
+		if fi != fj {
+			return fi < fj
+		}
+		if li != lj {
+			return li < lj
+		}
+		return issues[i].Message < issues[j].Message
+	})
+}
+
+func (cfg *Config) addIssue(pos string, format string, args ...any) {
+	cfg.Issues = append(cfg.Issues, &ConfigIssue{Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+// luaCallerPos returns the position of the Lua code that calls the current Go function.
+func luaCallerPos(L *lua.LState) string {
+	return strings.TrimSuffix(L.Where(1), ":")
+}
+
+// setHostParam updates the host parameter like updateHost, and records the issues of the parameter in the config.
+func setHostParam(L *lua.LState, h *Host, key string, value lua.LValue) error {
+	if err := updateHost(h, key, value); err != nil {
+		return err
+	}
+	cfg := getConfigFromLState(L)
+	cfg.lintHostParam(luaCallerPos(L), h, key, value)
+	return nil
+}
+
+// hostLabel returns the label of the host like `host "web"` or `host template "base"` used in the issue messages.
+func (cfg *Config) hostLabel(h *Host) string {
+	if slices.Contains(cfg.Templates, h) {
+		return fmt.Sprintf("host template %q", h.Name)
+	}
+	return fmt.Sprintf("host %q", h.Name)
+}
+
+func (cfg *Config) lintHostParam(pos string, h *Host, key string, value lua.LValue) {
+	label := cfg.hostLabel(h)
+
+	if !slices.Contains(hostParameters, key) {
+		if suggestion := suggestWord(key, hostParameters); suggestion != "" {
+			cfg.addIssue(pos, "%s: unknown parameter %q (did you mean %q?)", label, key, suggestion)
+		} else {
+			cfg.addIssue(pos, "%s: unknown parameter %q", label, key)
+		}
+		return
+	}
+
+	switch key {
+	case "name", "description", "match":
+		if s := lua.LVAsString(value); strings.ContainsAny(s, "\r\n") {
+			cfg.addIssue(pos, "%s: %s contains a newline", label, key)
+		}
+	case "tags", "extends":
+		cfg.lintListParam(pos, label, key, value, func(v lua.LValue) bool {
+			return v.Type() == lua.LTString
+		}, "a string")
+	case "on_before_connect", "on_after_connect", "on_after_disconnect", "on_before_command", "on_after_command":
+		cfg.lintListParam(pos, label, key, value, func(v lua.LValue) bool {
+			return v.Type() == lua.LTString || v.Type() == lua.LTFunction || v.Type() == lua.LTTable
+		}, "a string, a function or an argv list")
+	case "tunnels":
+		cfg.lintListParam(pos, label, key, value, func(v lua.LValue) bool {
+			return v.Type() == lua.LTTable
+		}, "a table")
+	case "ssh_config":
+		tb, ok := value.(*lua.LTable)
+		if !ok {
+			return
+		}
+		// sort the keys to report the issues in a stable order
+		keys := make([]string, 0)
+		tb.ForEach(func(k, _ lua.LValue) {
+			keys = append(keys, lua.LVAsString(k))
+		})
+		sort.Strings(keys)
+		for _, k := range keys {
+			cfg.lintSSHConfigEntry(pos, label, h, k, tb.RawGetString(k))
+		}
+	}
+}
+
+// lintListParam reports the entries of the table parameter that are ignored because of their types.
+func (cfg *Config) lintListParam(pos string, label string, key string, value lua.LValue, valid func(lua.LValue) bool, want string) {
+	tb, ok := value.(*lua.LTable)
+	if !ok {
+		return
+	}
+	tb.ForEach(func(k, v lua.LValue) {
+		if !valid(v) {
+			cfg.addIssue(pos, "%s: %s[%s] must be %s but got %s (ignored)", label, key, lua.LVAsString(k), want, v.Type().String())
+		}
+	})
+}
+
+func (cfg *Config) lintSSHConfigEntry(pos string, label string, h *Host, key string, value lua.LValue) {
+	if key == "" {
+		return
+	}
+
+	keyword, ok := lookupSSHConfigKeyword(key)
+	if !ok {
+		if !matchSSHPatternList(h.sshConfigValue("IgnoreUnknown"), key) {
+			if suggestion := suggestWord(key, sshConfigKeywords); suggestion != "" {
+				cfg.addIssue(pos, "%s: unknown ssh_config keyword %q (did you mean %q?)", label, key, suggestion)
+			} else {
+				cfg.addIssue(pos, "%s: unknown ssh_config keyword %q", label, key)
+			}
+		}
+	} else if keyword == "Host" || keyword == "Match" {
+		cfg.addIssue(pos, "%s: ssh_config keyword %q starts a new section in the generated ssh_config (use the host name or the match parameter)", label, key)
+	}
+
+	values := []lua.LValue{value}
+	if tb, ok := value.(*lua.LTable); ok {
+		values = values[:0]
+		for i := 1; i <= tb.Len(); i++ {
+			values = append(values, tb.RawGetInt(i))
+		}
+		if len(values) == 0 {
+			cfg.addIssue(pos, "%s: ssh_config %q is an empty table", label, key)
+		}
+	}
+	for _, v := range values {
+		switch v.Type() {
+		case lua.LTString, lua.LTNumber, lua.LTBool:
+			if strings.ContainsAny(lua.LVAsString(v), "\r\n") {
+				cfg.addIssue(pos, "%s: ssh_config %q contains a newline (use an array table for multiple values)", label, key)
+			}
+		default:
+			cfg.addIssue(pos, "%s: ssh_config %q must be a string, a number, a boolean or an array of them but got %s", label, key, v.Type().String())
+		}
+	}
+	if strings.ContainsAny(key, " \t\r\n") {
+		cfg.addIssue(pos, "%s: ssh_config keyword %q contains whitespace", label, key)
+	}
+}
+
+// sshConfigValue returns the ssh_config value of the host. The keyword is case-insensitive.
+func (h *Host) sshConfigValue(keyword string) string {
+	for k, v := range h.SSHConfig {
+		if strings.EqualFold(k, keyword) {
+			return v
+		}
+	}
+	return ""
+}
+
+// lintHosts reports the issues across the hosts. It must be called after the host templates are resolved.
+func (cfg *Config) lintHosts() {
+	seen := map[string]*Host{}
+	for _, h := range cfg.Hosts {
+		if first, ok := seen[h.Name]; ok {
+			cfg.addIssue(h.pos, "%s: duplicate host name (first defined at %s)", cfg.hostLabel(h), first.pos)
+		} else {
+			seen[h.Name] = h
+		}
+	}
+
+	for _, h := range append(append([]*Host{}, cfg.Templates...), cfg.Hosts...) {
+		keys := map[string][]string{}
+		for k := range h.SSHConfig {
+			lower := strings.ToLower(k)
+			keys[lower] = append(keys[lower], k)
+		}
+		for _, k := range slices.Sorted(maps.Keys(keys)) {
+			if variants := keys[k]; len(variants) > 1 {
+				sort.Strings(variants)
+				cfg.addIssue(h.pos, "%s: ssh_config keyword is defined multiple times in different cases: %s", cfg.hostLabel(h), strings.Join(variants, ", "))
+			}
+		}
+	}
+}
+
+// suggestWord returns the candidate closest to the word in terms of the edit distance ignoring case.
+// It returns an empty string if no candidates are close enough.
+func suggestWord(word string, candidates []string) string {
+	best := ""
+	bestDistance := 0
+	threshold := max(1, len(word)/3)
+	for _, c := range candidates {
+		d := editDistance(strings.ToLower(word), strings.ToLower(c))
+		if d <= threshold && (best == "" || d < bestDistance) {
+			best = c
+			bestDistance = d
+		}
+	}
+	return best
+}
+
+// editDistance returns the edit distance between a and b.
+// It counts insertions, deletions, substitutions and transpositions of adjacent characters.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestConfigIssues(t *testing.T) {
+	L := newLState()
+	defer L.Close()
+
+	err := L.DoString(`
+host_template "base" {
+  ssh_config = {
+    User = "deploy",
+    Prot = "22",
+  },
+}
+
+host "web1" {
+  descripton = "web server",
+  extends = "base",
+  tags = { "prod", 1 },
+  ssh_config = {
+    HostName = "192.168.0.1\nProxyCommand evil",
+    user = "root", User = "admin",
+    IgnoreUnknown = "UseKeychain2",
+    UseKeychain2 = "yes",
+  },
+  on_before_connect = { "echo hi", 42, {"echo", "argv"} },
+}
+
+local h = host "web2"
+h.hiden = true
+h.name = "web1"
+
+host "web3" {
+  ssh_config = {
+    Match = "exec true",
+    Port = {},
+    IdentityFile = { "~/.ssh/id_a", {} },
+  },
+}
+`)
+	assert.NoError(t, err)
+
+	cfg := getConfigFromLState(L)
+	assert.NoError(t, cfg.resolveHostTemplates())
+	cfg.lintHosts()
+	sortConfigIssues(cfg.Issues)
+
+	issues := make([]string, 0, len(cfg.Issues))
+	for _, issue := range cfg.Issues {
+		issues = append(issues, issue.String())
+	}
+	assert.Equal(t, []string{
+		`<string>:2: host template "base": unknown ssh_config keyword "Prot" (did you mean "Port"?)`,
+		`<string>:9: host "web1": on_before_connect[2] must be a string, a function or an argv list but got number (ignored)`,
+		`<string>:9: host "web1": ssh_config "HostName" contains a newline (use an array table for multiple values)`,
+		`<string>:9: host "web1": ssh_config keyword is defined multiple times in different cases: User, user`,
+		`<string>:9: host "web1": tags[2] must be a string but got number (ignored)`,
+		`<string>:9: host "web1": unknown parameter "descripton" (did you mean "description"?)`,
+		`<string>:22: host "web1": duplicate host name (first defined at <string>:9)`,
+		`<string>:23: host "web2": unknown parameter "hiden" (did you mean "hidden"?)`,
+		`<string>:26: host "web3": ssh_config "IdentityFile" must be a string, a number, a boolean or an array of them but got table`,
+		`<string>:26: host "web3": ssh_config "Port" is an empty table`,
+		`<string>:26: host "web3": ssh_config keyword "Match" starts a new section in the generated ssh_config (use the host name or the match parameter)`,
+	}, issues)
+}
+
+func TestSuggestWord(t *testing.T) {
+	testCases := []struct {
+		word     string
+		expected string
+	}{
+		{word: "descripton", expected: "description"},
+		{word: "hiden", expected: "hidden"},
+		{word: "Hostname", expected: "HostName"},
+		{word: "Prot", expected: "Port"},
+		{word: "IdentityFiles", expected: "IdentityFile"},
+		{word: "Foo", expected: ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.word, func(t *testing.T) {
+			assert.Equal(t, tc.expected, suggestWord(tc.word, append(append([]string{}, hostParameters...), sshConfigKeywords...)))
+		})
+	}
+}
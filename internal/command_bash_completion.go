@@ -0,0 +1,12 @@
+package internal
+
+import (
+	_ "embed"
+	"text/template"
+)
+
+var BashCompletionCommand = newCompletionCommand("bash", bashTmpl)
+
+//go:embed bash_completion.tmpl.bash
+var bashTemplateString string
+var bashTmpl = template.Must(template.New("T").Funcs(completionTemplateFuncs).Parse(bashTemplateString))
@@ -0,0 +1,35 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"github.com/urfave/cli/v3"
+	"os"
+)
+
+var CacheCommand = &cli.Command{
+	Name:                   "cache",
+	Usage:                  "Manage the cache of the evaluated config and inventories",
+	UseShortOptionHandling: true,
+	Action: func(ctx context.Context, cmd *cli.Command) error {
+		return cli.ShowSubcommandHelp(cmd)
+	},
+	Commands: []*cli.Command{
+		{
+			Name:                   "clear",
+			Usage:                  "Remove all the cache files",
+			UseShortOptionHandling: true,
+			CustomHelpTemplate:     helpTemplate,
+			Action:                 cacheClearAction,
+		},
+	},
+}
+
+func cacheClearAction(ctx context.Context, cmd *cli.Command) error {
+	dir := getCacheDir()
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(cmd.Writer, "Removed the cache in %s\n", dir)
+	return nil
+}
@@ -0,0 +1,34 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"github.com/urfave/cli/v3"
+)
+
+var CheckCommand = &cli.Command{
+	Name:                   "check",
+	Usage:                  "Check the config file for problems",
+	UseShortOptionHandling: true,
+	CustomHelpTemplate:     helpTemplate,
+	Action:                 checkAction,
+	Flags:                  []cli.Flag{},
+}
+
+func checkAction(ctx context.Context, cmd *cli.Command) error {
+	cfg, L, err := newConfig(cmd)
+	if err != nil {
+		return err
+	}
+	defer L.Close()
+
+	sortConfigIssues(cfg.Issues)
+	for _, issue := range cfg.Issues {
+		_, _ = fmt.Fprintln(cmd.Writer, issue)
+	}
+	if n := len(cfg.Issues); n > 0 {
+		return cli.Exit(fmt.Sprintf("%d problem(s) found in %s", n, cfg.FilepathsString()), 1)
+	}
+	_, _ = fmt.Fprintf(cmd.Writer, "No problems found in %s\n", cfg.FilepathsString())
+	return nil
+}
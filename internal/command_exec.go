@@ -0,0 +1,247 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"github.com/Songmu/wrapcommander"
+	"github.com/kohkimakimoto/xs/internal/debuglogger"
+	"github.com/urfave/cli/v3"
+	"github.com/yuin/gopher-lua"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ExecCommand = &cli.Command{
+	Name:               "exec",
+	Usage:              "Run a command on multiple hosts in parallel",
+	ArgsUsage:          "[options] <selector> [--] <command> [args ...]",
+	CustomHelpTemplate: helpTemplate,
+	// The flags are parsed by parseExecArgs, so that the options of the remote command are not taken as the flags of xs.
+	// They are defined only to be shown in the help.
+	SkipFlagParsing: true,
+	Action:          execAction,
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:    "parallel",
+			Aliases: []string{"p"},
+			Value:   defaultExecParallel,
+			Usage:   "Maximum number of hosts to run the command on at the same time (0 means unlimited)",
+		},
+		&cli.BoolFlag{
+			Name:    "all",
+			Aliases: []string{"a"},
+			Usage:   "Include hidden hosts when matching hosts",
+		},
+	},
+}
+
+// defaultExecParallel is the default maximum number of hosts to run the command on at the same time.
+const defaultExecParallel = 10
+
+// execOptions is the options of the exec command.
+type execOptions struct {
+	Parallel int
+	All      bool
+}
+
+// parseExecArgs parses the options of the exec command that precede the selector.
+// The arguments after the selector are returned as they are, even if they start with "-".
+func parseExecArgs(args []string) (*execOptions, []string, error) {
+	opts := &execOptions{Parallel: defaultExecParallel}
+	for i := 0; i < len(args); i++ {
+		v := args[i]
+		if v == "--" {
+			return opts, args[i+1:], nil
+		}
+		if !strings.HasPrefix(v, "-") || v == "-" {
+			return opts, args[i:], nil
+		}
+
+		// The short flags start with "-" and the long flags start with "--", like "-p 5" or "--parallel=5".
+		name, value, hasValue := strings.Cut(v, "=")
+		switch name {
+		case "-a", "--all":
+			if hasValue {
+				return nil, nil, fmt.Errorf("flag does not take a value: %s", v)
+			}
+			opts.All = true
+		case "-p", "--parallel":
+			if !hasValue {
+				if i+1 >= len(args) {
+					return nil, nil, fmt.Errorf("flag needs an argument: %s", v)
+				}
+				i++
+				value = args[i]
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid value %q for flag %s", value, v)
+			}
+			opts.Parallel = n
+		default:
+			return nil, nil, fmt.Errorf("flag provided but not defined: %s", v)
+		}
+	}
+	return opts, nil, nil
+}
+
+type execResult struct {
+	Host *Host
+	Err  error
+}
+
+func execAction(ctx context.Context, cmd *cli.Command) error {
+	logger := debuglogger.Get(cmd)
+
+	args := cmd.Args().Slice()
+	if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+		return cli.ShowSubcommandHelp(cmd)
+	}
+	opts, args, err := parseExecArgs(args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 && args[1] == "--" {
+		// "--" between the selector and the command is optional.
+		args = append(args[:1:1], args[2:]...)
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("host selector and command are required")
+	}
+	selector, err := ParseHostSelector(args[0])
+	if err != nil {
+		return err
+	}
+	command := strings.Join(args[1:], " ")
+
+	cfg, L, err := newConfig(cmd)
+	if err != nil {
+		return err
+	}
+	defer L.Close()
+
+	f := cfg.NewHostFilter().ExcludePatterns()
+	if !opts.All {
+		f.ExcludeHidden()
+	}
+	hosts := f.Select(selector).GetHosts()
+	if len(hosts) == 0 {
+		return fmt.Errorf("no hosts matched: %s", args[0])
+	}
+
+	sshConfigFile, removeSSHConfigFile, err := writeSSHConfigFile(cfg)
+	if err != nil {
+		return err
+	}
+	defer removeSSHConfigFile()
+
+	logger.Printf("generated ssh config file: %s", sshConfigFile)
+
+	width := 0
+	for _, h := range hosts {
+		if len(h.Name) > width {
+			width = len(h.Name)
+		}
+	}
+
+	parallel := opts.Parallel
+	if parallel <= 0 {
+		parallel = len(hosts)
+	}
+
+	var mu sync.Mutex
+	// luaMu serializes the evaluation of the hooks because the Lua state can not be used concurrently.
+	var luaMu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, parallel)
+	results := make([]*execResult, len(hosts))
+	for i, h := range hosts {
+		wg.Add(1)
+		go func(i int, h *Host) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			prefix := fmt.Sprintf("%-*s | ", width, h.Name)
+			stdout := newPrefixWriter(&mu, cmd.Writer, prefix)
+			stderr := newPrefixWriter(&mu, cmd.ErrWriter, prefix)
+
+			// Run the on_before_command and on_after_command hooks around the command like "xs <host> <command>".
+			hooks := newConnectionHooks(findHookHosts(cfg, h, h.Name))
+			hookCtx := newHookContext(cfg, h, h.Name, []string{}, command)
+			if len(hooks.OnBeforeCommand) > 0 {
+				err := runExecHooks(cmd, L, &luaMu, "on_before_command", hooks.OnBeforeCommand, hookCtx, stdout, stderr)
+				if err != nil {
+					_, _ = fmt.Fprintf(stderr, "failed to run on_before_command: %v\n", err)
+					_ = stdout.Flush()
+					_ = stderr.Flush()
+					results[i] = &execResult{Host: h, Err: err}
+					return
+				}
+			}
+
+			eCmd := exec.CommandContext(ctx, "ssh", "-F", sshConfigFile, h.Name, command)
+			eCmd.Stdout = stdout
+			eCmd.Stderr = stderr
+
+			logger.Printf("underlying ssh command: %v", eCmd.Args)
+
+			startTime := time.Now()
+			err := eCmd.Run()
+			hookCtx.setResult(err, time.Since(startTime))
+			_ = stdout.Flush()
+			_ = stderr.Flush()
+			results[i] = &execResult{Host: h, Err: err}
+
+			if len(hooks.OnAfterCommand) > 0 {
+				hookErr := runExecHooks(cmd, L, &luaMu, "on_after_command", hooks.OnAfterCommand, hookCtx, stdout, stderr)
+				if hookErr != nil {
+					_, _ = fmt.Fprintf(stderr, "failed to run on_after_command: %v\n", hookErr)
+				}
+				_ = stdout.Flush()
+				_ = stderr.Flush()
+			}
+		}(i, h)
+	}
+	wg.Wait()
+
+	failed := make([]string, 0)
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, fmt.Sprintf("%s (exit status %d)", r.Host.Name, wrapcommander.ResolveExitCode(r.Err)))
+		}
+	}
+	if len(failed) > 0 {
+		return cli.Exit(fmt.Sprintf("%d of %d hosts failed: %s", len(failed), len(hosts), strings.Join(failed, ", ")), 1)
+	}
+	return nil
+}
+
+// runExecHooks runs the hooks of a host for the exec command.
+// Only the evaluation of the hooks is serialized by the luaMu, and the hook script runs in parallel with the other hosts.
+// The output of the script is prefixed like the output of the command, and it does not read the stdin shared by the hosts.
+func runExecHooks(cmd *cli.Command, L *lua.LState, luaMu *sync.Mutex, name string, hooks []any, hookCtx *hookContext, stdout io.Writer, stderr io.Writer) error {
+	logger := debuglogger.Get(cmd)
+
+	luaMu.Lock()
+	logger.Printf("run hooks: run %s", name)
+	script, err := createHookScript(L, hooks, hookCtx.toLuaTable(L))
+	luaMu.Unlock()
+	if err != nil {
+		return err
+	}
+	if script == "" {
+		return nil
+	}
+	logger.Printf("hook script (local):")
+	logger.PrintfNoPrefix("%s", script)
+
+	hookCmd := newHookScriptCommand(script)
+	hookCmd.Stdout = stdout
+	hookCmd.Stderr = stderr
+	return hookCmd.Run()
+}
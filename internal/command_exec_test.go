@@ -0,0 +1,159 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseExecArgs(t *testing.T) {
+	for _, tt := range []struct {
+		args     []string
+		opts     *execOptions
+		expected []string
+	}{
+		{[]string{"web1", "uptime"}, &execOptions{Parallel: defaultExecParallel}, []string{"web1", "uptime"}},
+		{[]string{"-a", "-p", "2", "web1", "uptime"}, &execOptions{Parallel: 2, All: true}, []string{"web1", "uptime"}},
+		{[]string{"--all", "--parallel=0", "web1", "uptime"}, &execOptions{Parallel: 0, All: true}, []string{"web1", "uptime"}},
+		{[]string{"web1", "ps", "-a"}, &execOptions{Parallel: defaultExecParallel}, []string{"web1", "ps", "-a"}},
+		{[]string{"-p", "3", "web1", "--", "ls", "-la"}, &execOptions{Parallel: 3}, []string{"web1", "--", "ls", "-la"}},
+		{[]string{"--", "-web1", "uptime"}, &execOptions{Parallel: defaultExecParallel}, []string{"-web1", "uptime"}},
+	} {
+		opts, args, err := parseExecArgs(tt.args)
+		require.NoError(t, err, tt.args)
+		assert.Equal(t, tt.opts, opts, tt.args)
+		assert.Equal(t, tt.expected, args, tt.args)
+	}
+
+	_, _, err := parseExecArgs([]string{"-x", "web1", "uptime"})
+	assert.EqualError(t, err, "flag provided but not defined: -x")
+	_, _, err = parseExecArgs([]string{"---all", "web1", "uptime"})
+	assert.EqualError(t, err, "flag provided but not defined: ---all")
+	_, _, err = parseExecArgs([]string{"-parallel", "2", "web1", "uptime"})
+	assert.EqualError(t, err, "flag provided but not defined: -parallel")
+	_, _, err = parseExecArgs([]string{"--a", "web1", "uptime"})
+	assert.EqualError(t, err, "flag provided but not defined: --a")
+	_, _, err = parseExecArgs([]string{"-p"})
+	assert.EqualError(t, err, "flag needs an argument: -p")
+	_, _, err = parseExecArgs([]string{"-p", "many", "web1", "uptime"})
+	assert.EqualError(t, err, `invalid value "many" for flag -p`)
+}
+
+func TestExecAction_PassesCommandFlags(t *testing.T) {
+	argsFile := installFakeSSH(t)
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.lua")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+host "web1" {}
+host "web2" { hidden = true }
+`), 0644))
+	t.Setenv("XS_CONFIG", configFile)
+
+	run := func(args ...string) []string {
+		app := newApp()
+		app.Writer = io.Discard
+		app.ErrWriter = io.Discard
+		require.NoError(t, app.Run(context.Background(), append([]string{"xs", "exec"}, args...)))
+
+		b, err := os.ReadFile(argsFile)
+		require.NoError(t, err)
+		require.NoError(t, os.Remove(argsFile))
+		lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+		for i, line := range lines {
+			// drop "-F <ssh_config>"
+			lines[i] = strings.SplitN(line, " ", 3)[2]
+		}
+		sort.Strings(lines)
+		return lines
+	}
+
+	// "-a" and "-p" after the selector belong to the remote command.
+	assert.Equal(t, []string{"web1 ps -a"}, run("web*", "ps", "-a"))
+	assert.Equal(t, []string{"web1 ls -p 1"}, run("web*", "ls", "-p", "1"))
+	assert.Equal(t, []string{"web1 ls -la"}, run("web*", "--", "ls", "-la"))
+	// "-a" before the selector includes the hidden hosts.
+	assert.Equal(t, []string{"web1 ps -a", "web2 ps -a"}, run("-a", "web*", "ps", "-a"))
+}
+
+func TestExecAction_Hooks(t *testing.T) {
+	argsFile := installFakeSSH(t)
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	hooksFile := filepath.Join(dir, "hooks.log")
+	configFile := filepath.Join(dir, "config.lua")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+local log = "`+hooksFile+`"
+host "web1" {}
+host "web2" {}
+host "db1" {
+  on_before_command = { "exit 1" },
+}
+
+host "*" {
+  on_before_command = { function(ctx) return "echo before " .. ctx.hostname .. " " .. ctx.command .. " >> " .. log end },
+  on_after_command = { function(ctx) return "echo after " .. ctx.hostname .. " " .. ctx.exit_code .. " >> " .. log end },
+}
+`), 0644))
+	t.Setenv("XS_CONFIG", configFile)
+
+	app := newApp()
+	app.Writer = io.Discard
+	app.ErrWriter = io.Discard
+	// cli.Exit exits the process by default.
+	app.ExitErrHandler = func(context.Context, *cli.Command, error) {}
+	err := app.Run(context.Background(), []string{"xs", "exec", "web1,web2,db1", "uptime"})
+	assert.EqualError(t, err, "1 of 3 hosts failed: db1 (exit status 1)")
+
+	b, err := os.ReadFile(hooksFile)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	sort.Strings(lines)
+	assert.Equal(t, []string{"after web1 0", "after web2 0", "before web1 uptime", "before web2 uptime"}, lines)
+
+	// the command is not run on the host whose on_before_command hook fails
+	b, err = os.ReadFile(argsFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), "db1")
+}
+
+func TestExecAction_ParallelHooks(t *testing.T) {
+	installFakeSSH(t)
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.lua")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+host "web1" {}
+host "web2" {}
+
+host "web*" {
+  on_before_command = { function(ctx) return "sleep 0.5; echo before " .. ctx.hostname end },
+}
+`), 0644))
+	t.Setenv("XS_CONFIG", configFile)
+
+	// The writers are not inherited from the root command.
+	var out bytes.Buffer
+	writer, errWriter := ExecCommand.Writer, ExecCommand.ErrWriter
+	ExecCommand.Writer, ExecCommand.ErrWriter = &out, io.Discard
+	t.Cleanup(func() { ExecCommand.Writer, ExecCommand.ErrWriter = writer, errWriter })
+
+	app := newApp()
+	start := time.Now()
+	require.NoError(t, app.Run(context.Background(), []string{"xs", "exec", "web*", "uptime"}))
+
+	// The hook scripts of the hosts run at the same time.
+	assert.Less(t, time.Since(start), 900*time.Millisecond)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	sort.Strings(lines)
+	assert.Equal(t, []string{"web1 | before web1", "web2 | before web2"}, lines)
+}
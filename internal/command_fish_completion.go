@@ -0,0 +1,12 @@
+package internal
+
+import (
+	_ "embed"
+	"text/template"
+)
+
+var FishCompletionCommand = newCompletionCommand("fish", fishTmpl)
+
+//go:embed fish_completion.tmpl.fish
+var fishTemplateString string
+var fishTmpl = template.Must(template.New("T").Funcs(completionTemplateFuncs).Parse(fishTemplateString))
@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"github.com/kohkimakimoto/xs/internal/debuglogger"
+	"github.com/urfave/cli/v3"
+	"path/filepath"
+	"strings"
+)
+
+var ImportCommand = &cli.Command{
+	Name:                   "import",
+	Usage:                  "Import ssh_config into the Lua configuration",
+	ArgsUsage:              "[path]",
+	UseShortOptionHandling: true,
+	CustomHelpTemplate:     helpTemplate,
+	Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+		// Disable debug output because it will break the output.
+		debuglogger.Get(cmd).IsDebug = false
+		return ctx, nil
+	},
+	Action: importAction,
+	Flags:  []cli.Flag{},
+}
+
+func importAction(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Args().Len() > 1 {
+		return cli.ShowSubcommandHelp(cmd)
+	}
+	path := "~/.ssh/config"
+	if cmd.Args().Present() {
+		path = cmd.Args().First()
+	}
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		path = filepath.Join(userHomeDir(), path[1:])
+	}
+
+	lua, warnings, err := importSSHConfig(path)
+	if err != nil {
+		return err
+	}
+	for _, w := range warnings {
+		_, _ = fmt.Fprintf(cmd.ErrWriter, "warning: %s\n", w)
+	}
+	_, _ = fmt.Fprint(cmd.Writer, lua)
+	return nil
+}
@@ -2,10 +2,16 @@ package internal
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/kohkimakimoto/xs/internal/debuglogger"
 	"github.com/urfave/cli/v3"
+	"gopkg.in/yaml.v3"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
 )
 
 var ListCommand = &cli.Command{
@@ -24,39 +30,255 @@ var ListCommand = &cli.Command{
 		&cli.BoolFlag{
 			Name:    "all",
 			Aliases: []string{"a"},
-			Usage:   "List all hosts including hidden hosts",
+			Usage:   "List all hosts including hidden hosts and pattern hosts",
+		},
+		&cli.StringFlag{
+			Name:    "filter",
+			Aliases: []string{"f"},
+			Usage:   "List only hosts matched by the `selector` expression (e.g. \"tag:prod !tag:canary\")",
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "Output `format` (table, json, yaml or tsv)",
+			Value: "table",
+		},
+		&cli.BoolFlag{
+			Name:  "no-cache",
+			Usage: "Evaluate the config without the cache",
+		},
+		&cli.StringFlag{
+			Name:  "template",
+			Usage: "Output each host by the Go `template` (e.g. '{{.Name}} {{index .SSHConfig \"HostName\"}}')",
 		},
 	},
 }
 
 func listAction(ctx context.Context, cmd *cli.Command) error {
-	cfg, L, err := newConfig(cmd)
+	hosts, err := loadHostsForListing(cmd, cmd.Bool("no-cache"))
 	if err != nil {
 		return err
 	}
-	defer L.Close()
 
-	f := cfg.NewHostFilter()
+	f := &HostFilter{hosts: hosts}
 	if !cmd.Bool("all") {
-		f.ExcludeHidden()
+		f.ExcludeHidden().ExcludePatterns()
+	}
+	if expr := cmd.String("filter"); expr != "" {
+		selector, err := ParseHostSelector(expr)
+		if err != nil {
+			return err
+		}
+		f.Select(selector)
+	}
+
+	hosts = f.GetHosts()
+
+	items := make([]*listItem, 0, len(hosts))
+	for _, h := range hosts {
+		items = append(items, newListItem(h))
+	}
+
+	if text := cmd.String("template"); text != "" {
+		return writeListTemplate(cmd.Writer, items, text)
 	}
 
-	hosts := f.GetHosts()
+	switch format := cmd.String("format"); format {
+	case "table":
+		writeListTable(cmd.Writer, items)
+		return nil
+	case "json":
+		return writeListJSON(cmd.Writer, items)
+	case "yaml":
+		return writeListYAML(cmd.Writer, items)
+	case "tsv":
+		return writeListTSV(cmd.Writer, items)
+	default:
+		return fmt.Errorf("unsupported format: %s (table, json, yaml or tsv is available)", format)
+	}
+}
+
+// listItem is the representation of a host in the output of the list command.
+type listItem struct {
+	Name        string            `json:"name" yaml:"name"`
+	Description string            `json:"description" yaml:"description"`
+	Hidden      bool              `json:"hidden" yaml:"hidden"`
+	Pattern     bool              `json:"pattern" yaml:"pattern"`
+	Tags        []string          `json:"tags" yaml:"tags"`
+	Extends     []string          `json:"extends" yaml:"extends"`
+	Match       string            `json:"match" yaml:"match"`
+	SSHConfig   map[string]string `json:"ssh_config" yaml:"ssh_config"`
+	Hooks       listItemHooks     `json:"hooks" yaml:"hooks"`
+	Tunnels     []*Tunnel         `json:"tunnels" yaml:"tunnels"`
+	// ImportedFrom is the path of the ssh_config file that the host is imported from.
+	ImportedFrom string `json:"imported_from" yaml:"imported_from"`
+}
+
+// listItemHooks is the number of the hooks of a host.
+type listItemHooks struct {
+	OnBeforeConnect   int `json:"on_before_connect" yaml:"on_before_connect"`
+	OnAfterConnect    int `json:"on_after_connect" yaml:"on_after_connect"`
+	OnAfterDisconnect int `json:"on_after_disconnect" yaml:"on_after_disconnect"`
+	OnBeforeCommand   int `json:"on_before_command" yaml:"on_before_command"`
+	OnAfterCommand    int `json:"on_after_command" yaml:"on_after_command"`
+}
+
+func newListItem(h *Host) *listItem {
+	sshConfig := make(map[string]string, len(h.SSHConfig))
+	for k, v := range h.SSHConfig {
+		sshConfig[k] = v
+	}
+	return &listItem{
+		Name:        h.Name,
+		Description: h.Description,
+		Hidden:      h.Hidden,
+		Pattern:     h.IsPattern(),
+		Tags:        append([]string{}, h.Tags...),
+		Extends:     append([]string{}, h.Extends...),
+		Match:       h.Match,
+		SSHConfig:   sshConfig,
+		Hooks: listItemHooks{
+			OnBeforeConnect:   len(h.OnBeforeConnect),
+			OnAfterConnect:    len(h.OnAfterConnect),
+			OnAfterDisconnect: len(h.OnAfterDisconnect),
+			OnBeforeCommand:   len(h.OnBeforeCommand),
+			OnAfterCommand:    len(h.OnAfterCommand),
+		},
+		Tunnels:      append([]*Tunnel{}, h.Tunnels...),
+		ImportedFrom: h.ImportedFrom,
+	}
+}
+
+// toHost restores the host from the list item for the hosts from the cache of the config.
+// The hooks are not restored, only the number of them is kept.
+func (item *listItem) toHost() *Host {
+	sshConfig := make(map[string]string, len(item.SSHConfig))
+	for k, v := range item.SSHConfig {
+		sshConfig[k] = v
+	}
+	return &Host{
+		Name:              item.Name,
+		Description:       item.Description,
+		Hidden:            item.Hidden,
+		Tags:              append([]string{}, item.Tags...),
+		Extends:           append([]string{}, item.Extends...),
+		Match:             item.Match,
+		SSHConfig:         sshConfig,
+		OnBeforeConnect:   make([]any, item.Hooks.OnBeforeConnect),
+		OnAfterConnect:    make([]any, item.Hooks.OnAfterConnect),
+		OnAfterDisconnect: make([]any, item.Hooks.OnAfterDisconnect),
+		OnBeforeCommand:   make([]any, item.Hooks.OnBeforeCommand),
+		OnAfterCommand:    make([]any, item.Hooks.OnAfterCommand),
+		Tunnels:           append([]*Tunnel{}, item.Tunnels...),
+		ImportedFrom:      item.ImportedFrom,
+	}
+}
 
-	t := newSimpleTableWriter(cmd.Writer)
+func writeListTable(out io.Writer, items []*listItem) {
+	t := newSimpleTableWriter(out)
 	t.AppendHeader(table.Row{
 		"Host",
 		"Description",
+		"Tags",
 		"Hidden",
 	})
 
-	for _, h := range hosts {
+	for _, item := range items {
 		t.AppendRow(table.Row{
-			h.Name,
-			h.Description,
-			fmt.Sprintf("%t", h.Hidden),
+			item.Name,
+			item.Description,
+			strings.Join(item.Tags, ","),
+			fmt.Sprintf("%t", item.Hidden),
 		})
 	}
 	t.Render()
+}
+
+func writeListJSON(out io.Writer, items []*listItem) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(items)
+}
+
+func writeListYAML(out io.Writer, items []*listItem) error {
+	encoder := yaml.NewEncoder(out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(items); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// writeListTSV outputs the hosts as tab-separated values with a header line.
+// The list values including the tunnels are joined by ",", and the ssh_config is output as "Key=Value" pairs joined by ",".
+// Tabs and newlines in the values are replaced with spaces to keep the format.
+func writeListTSV(out io.Writer, items []*listItem) error {
+	header := []string{
+		"name", "description", "hidden", "pattern", "tags", "extends", "match", "ssh_config",
+		"on_before_connect", "on_after_connect", "on_after_disconnect", "on_before_command", "on_after_command",
+		"tunnels", "imported_from",
+	}
+	if _, err := fmt.Fprintln(out, strings.Join(header, "\t")); err != nil {
+		return err
+	}
+
+	escape := strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+	for _, item := range items {
+		keys := make([]string, 0, len(item.SSHConfig))
+		for k := range item.SSHConfig {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		sshConfig := make([]string, 0, len(keys))
+		for _, k := range keys {
+			sshConfig = append(sshConfig, k+"="+item.SSHConfig[k])
+		}
+		tunnels := make([]string, 0, len(item.Tunnels))
+		for _, t := range item.Tunnels {
+			tunnels = append(tunnels, t.String())
+		}
+
+		fields := []string{
+			item.Name,
+			item.Description,
+			fmt.Sprintf("%t", item.Hidden),
+			fmt.Sprintf("%t", item.Pattern),
+			strings.Join(item.Tags, ","),
+			strings.Join(item.Extends, ","),
+			item.Match,
+			strings.Join(sshConfig, ","),
+			fmt.Sprintf("%d", item.Hooks.OnBeforeConnect),
+			fmt.Sprintf("%d", item.Hooks.OnAfterConnect),
+			fmt.Sprintf("%d", item.Hooks.OnAfterDisconnect),
+			fmt.Sprintf("%d", item.Hooks.OnBeforeCommand),
+			fmt.Sprintf("%d", item.Hooks.OnAfterCommand),
+			strings.Join(tunnels, ","),
+			item.ImportedFrom,
+		}
+		for i, field := range fields {
+			fields[i] = escape.Replace(field)
+		}
+		if _, err := fmt.Fprintln(out, strings.Join(fields, "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeListTemplate outputs each host by the Go template followed by a newline.
+func writeListTemplate(out io.Writer, items []*listItem, text string) error {
+	tmpl, err := template.New("list").Funcs(template.FuncMap{
+		"join": strings.Join,
+	}).Parse(text)
+	if err != nil {
+		return fmt.Errorf("failed to parse the template: %w", err)
+	}
+	for _, item := range items {
+		if err := tmpl.Execute(out, item); err != nil {
+			return fmt.Errorf("failed to execute the template: %w", err)
+		}
+		if _, err := fmt.Fprintln(out); err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/yuin/gopher-lua"
+	"strings"
+	"testing"
+)
+
+func testListItems() []*listItem {
+	return []*listItem{
+		newListItem(&Host{
+			Name:            "web1",
+			Description:     "web server\t1",
+			Tags:            []string{"prod", "web"},
+			Extends:         []string{"base"},
+			SSHConfig:       map[string]string{"HostName": "192.168.0.11", "User": "deploy"},
+			OnBeforeConnect: []any{lua.LString("echo before")},
+			OnAfterCommand:  []any{lua.LString("echo a"), lua.LString("echo b")},
+			Tunnels:         []*Tunnel{{Local: "5432", Remote: "db:5432"}},
+		}),
+		newListItem(&Host{
+			Name:   "*.example.com",
+			Hidden: true,
+		}),
+	}
+}
+
+func TestWriteListJSON(t *testing.T) {
+	out := &bytes.Buffer{}
+	err := writeListJSON(out, testListItems()[:1])
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+  {
+    "name": "web1",
+    "description": "web server\t1",
+    "hidden": false,
+    "pattern": false,
+    "tags": ["prod", "web"],
+    "extends": ["base"],
+    "match": "",
+    "ssh_config": {"HostName": "192.168.0.11", "User": "deploy"},
+    "hooks": {
+      "on_before_connect": 1,
+      "on_after_connect": 0,
+      "on_after_disconnect": 0,
+      "on_before_command": 0,
+      "on_after_command": 2
+    },
+    "tunnels": [{"local": "5432", "remote": "db:5432"}],
+    "imported_from": ""
+  }
+]`, out.String())
+}
+
+func TestWriteListYAML(t *testing.T) {
+	out := &bytes.Buffer{}
+	err := writeListYAML(out, testListItems()[1:])
+	assert.NoError(t, err)
+	assert.Equal(t, strings.TrimPrefix(`
+- name: '*.example.com'
+  description: ""
+  hidden: true
+  pattern: true
+  tags: []
+  extends: []
+  match: ""
+  ssh_config: {}
+  hooks:
+    on_before_connect: 0
+    on_after_connect: 0
+    on_after_disconnect: 0
+    on_before_command: 0
+    on_after_command: 0
+  tunnels: []
+  imported_from: ""
+`, "\n"), out.String())
+}
+
+func TestWriteListTSV(t *testing.T) {
+	items := testListItems()
+	items[0].Tunnels = append(items[0].Tunnels, &Tunnel{Local: "127.0.0.1:8080", Remote: "localhost:80"})
+	out := &bytes.Buffer{}
+	err := writeListTSV(out, items)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"name\tdescription\thidden\tpattern\ttags\textends\tmatch\tssh_config\ton_before_connect\ton_after_connect\ton_after_disconnect\ton_before_command\ton_after_command\ttunnels\timported_from",
+		"web1\tweb server 1\tfalse\tfalse\tprod,web\tbase\t\tHostName=192.168.0.11,User=deploy\t1\t0\t0\t0\t2\t5432 -> db:5432,127.0.0.1:8080 -> localhost:80\t",
+		"*.example.com\t\ttrue\ttrue\t\t\t\t\t0\t0\t0\t0\t0\t\t",
+	}, strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n"))
+}
+
+func TestWriteListTemplate(t *testing.T) {
+	out := &bytes.Buffer{}
+	err := writeListTemplate(out, testListItems(), `{{.Name}} {{index .SSHConfig "HostName"}} {{join .Tags ","}} {{.Hooks.OnAfterCommand}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "web1 192.168.0.11 prod,web 2\n*.example.com   0\n", out.String())
+
+	err = writeListTemplate(out, testListItems(), `{{.Name`)
+	assert.ErrorContains(t, err, "failed to parse the template")
+}
@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/kohkimakimoto/xs/internal/debuglogger"
+	"github.com/urfave/cli/v3"
+)
+
+var MuxCommand = &cli.Command{
+	Name:                   "mux",
+	Usage:                  "Manage the multiplexed connections",
+	UseShortOptionHandling: true,
+	Action: func(ctx context.Context, cmd *cli.Command) error {
+		return cli.ShowSubcommandHelp(cmd)
+	},
+	Commands: []*cli.Command{
+		{
+			Name:                   "status",
+			Usage:                  "Show the multiplexed connections (all the running ones if no host is specified)",
+			ArgsUsage:              "[host ...]",
+			UseShortOptionHandling: true,
+			CustomHelpTemplate:     helpTemplate,
+			Action:                 muxStatusAction,
+		},
+		{
+			Name:                   "stop",
+			Usage:                  "Stop the multiplexed connections (all the running ones if no host is specified)",
+			ArgsUsage:              "[host ...]",
+			UseShortOptionHandling: true,
+			CustomHelpTemplate:     helpTemplate,
+			Action:                 muxStopAction,
+		},
+	},
+}
+
+// muxConnection is the state of the master process of a host found by "ssh -O check".
+type muxConnection struct {
+	Host    string
+	Running bool
+	Pid     int
+}
+
+// checkMuxConnections checks the master processes of the hosts with the generated ssh_config.
+// If no host is specified, it checks all the concrete hosts and returns only the running ones.
+// The returned function removes the generated ssh_config file.
+func checkMuxConnections(cmd *cli.Command, names []string) ([]*muxConnection, string, func(), error) {
+	logger := debuglogger.Get(cmd)
+
+	cfg, L, err := newConfig(cmd)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	defer L.Close()
+
+	sshConfigFile, removeSSHConfigFile, err := writeSSHConfigFile(cfg)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	logger.Printf("generated ssh config file: %s", sshConfigFile)
+
+	onlyRunning := len(names) == 0
+	if onlyRunning {
+		for _, h := range cfg.NewHostFilter().ExcludePatterns().GetHosts() {
+			names = append(names, h.Name)
+		}
+	}
+
+	conns := make([]*muxConnection, 0, len(names))
+	for _, name := range names {
+		c := &muxConnection{Host: name}
+		if out, err := runSSHControl("check", "-F", sshConfigFile, name); err == nil {
+			c.Running = true
+			c.Pid, _ = parseMasterPid(out)
+		} else {
+			logger.Printf("%s: %v", name, err)
+		}
+		if c.Running || !onlyRunning {
+			conns = append(conns, c)
+		}
+	}
+	return conns, sshConfigFile, removeSSHConfigFile, nil
+}
+
+func muxStatusAction(ctx context.Context, cmd *cli.Command) error {
+	conns, _, removeSSHConfigFile, err := checkMuxConnections(cmd, cmd.Args().Slice())
+	if err != nil {
+		return err
+	}
+	removeSSHConfigFile()
+
+	if len(conns) == 0 {
+		_, _ = fmt.Fprintln(cmd.Writer, "No multiplexed connections are running")
+		return nil
+	}
+
+	t := newSimpleTableWriter(cmd.Writer)
+	t.AppendHeader(table.Row{"Host", "Status", "PID"})
+	for _, c := range conns {
+		if c.Running {
+			t.AppendRow(table.Row{c.Host, "running", c.Pid})
+		} else {
+			t.AppendRow(table.Row{c.Host, "stopped", "-"})
+		}
+	}
+	t.Render()
+	return nil
+}
+
+func muxStopAction(ctx context.Context, cmd *cli.Command) error {
+	conns, sshConfigFile, removeSSHConfigFile, err := checkMuxConnections(cmd, cmd.Args().Slice())
+	if err != nil {
+		return err
+	}
+	defer removeSSHConfigFile()
+
+	if len(conns) == 0 {
+		_, _ = fmt.Fprintln(cmd.Writer, "No multiplexed connections are running")
+		return nil
+	}
+
+	for _, c := range conns {
+		if !c.Running {
+			_, _ = fmt.Fprintf(cmd.Writer, "%s: not running\n", c.Host)
+			continue
+		}
+		if _, err := runSSHControl("exit", "-F", sshConfigFile, c.Host); err != nil {
+			return fmt.Errorf("failed to stop the multiplexed connection of %s: %w", c.Host, err)
+		}
+		_, _ = fmt.Fprintf(cmd.Writer, "%s: stopped\n", c.Host)
+	}
+	return nil
+}
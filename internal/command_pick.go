@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/urfave/cli/v3"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"slices"
+)
+
+var PickCommand = &cli.Command{
+	Name:               "pick",
+	Usage:              "Pick a host interactively and connect to it",
+	ArgsUsage:          "[ssh options ...] [-- command [args ...]]",
+	SkipFlagParsing:    true,
+	CustomHelpTemplate: helpTemplate,
+	Action:             pickAction,
+}
+
+// pickerMaxHeight is the maximum number of the candidates displayed at once.
+const pickerMaxHeight = 15
+
+func pickAction(ctx context.Context, cmd *cli.Command) error {
+	args := cmd.Args().Slice()
+	if len(args) > 0 && (args[0] == "--help" || args[0] == "-h") {
+		return cli.ShowSubcommandHelp(cmd)
+	}
+	return pickAndRun(ctx, cmd, args)
+}
+
+// pickAndRun lets the user pick a host and connects to it.
+// The arguments before "--" are passed to ssh as options, and the arguments after "--" are the command to run.
+func pickAndRun(ctx context.Context, cmd *cli.Command, args []string) error {
+	options := args
+	var command []string
+	if i := slices.Index(args, "--"); i >= 0 {
+		options = args[:i]
+		command = args[i+1:]
+	}
+
+	cfg, L, err := newConfig(cmd)
+	if err != nil {
+		return err
+	}
+	defer L.Close()
+
+	hosts := cfg.NewHostFilter().ExcludeHidden().ExcludePatterns().GetHosts()
+	if len(hosts) == 0 {
+		return fmt.Errorf("no hosts to pick")
+	}
+
+	items := make([]*pickerItem, 0, len(hosts))
+	for _, h := range hosts {
+		items = append(items, &pickerItem{Name: h.Name, Description: h.Description, Tags: h.Tags})
+	}
+
+	item, err := runPickerOnTerminal(items)
+	if err != nil {
+		if errors.Is(err, errPickerCanceled) {
+			// exit with the same status as fzf
+			return cli.Exit("", 130)
+		}
+		return err
+	}
+
+	runArgs := append(append(append([]string{}, options...), item.Name), command...)
+	return runWithConfig(ctx, cmd, cfg, L, runArgs)
+}
+
+// runPickerOnTerminal runs the picker on the controlling terminal, so that it works even if STDIN is redirected.
+func runPickerOnTerminal(items []*pickerItem) (*pickerItem, error) {
+	var in *os.File
+	var out io.Writer
+	if tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0); err == nil {
+		defer func() { _ = tty.Close() }()
+		in, out = tty, tty
+	} else {
+		in, out = os.Stdin, os.Stderr
+	}
+
+	fd := int(in.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("picking a host requires a terminal")
+	}
+
+	height := pickerMaxHeight
+	if _, h, err := term.GetSize(fd); err == nil {
+		// leave the lines for the prompt and the status
+		height = min(height, h-2)
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = term.Restore(fd, state) }()
+
+	return newPicker(in, out, items, height, getNoColorFlag()).Run()
+}
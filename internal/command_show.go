@@ -0,0 +1,243 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/kohkimakimoto/xs/internal/debuglogger"
+	"github.com/urfave/cli/v3"
+	"github.com/yuin/gopher-lua"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var ShowCommand = &cli.Command{
+	Name:                   "show",
+	Usage:                  "Show the details of a host",
+	ArgsUsage:              "<host>",
+	UseShortOptionHandling: true,
+	CustomHelpTemplate:     helpTemplate,
+	Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+		// Disable debug output because it will break the output.
+		debuglogger.Get(cmd).IsDebug = false
+		return ctx, nil
+	},
+	Action: showAction,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "effective",
+			Aliases: []string{"e"},
+			Usage:   "Show the effective ssh options resolved by \"ssh -G\" with the generated ssh_config",
+		},
+	},
+}
+
+func showAction(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Args().Len() != 1 {
+		return cli.ShowSubcommandHelp(cmd)
+	}
+	name := cmd.Args().First()
+
+	cfg, L, err := newConfig(cmd)
+	if err != nil {
+		return err
+	}
+	defer L.Close()
+
+	host := cfg.NewHostFilter().GetHostByName(name)
+	if host == nil {
+		return fmt.Errorf("host not found: %s", name)
+	}
+
+	out := cmd.Writer
+	writeShowHost(out, host)
+
+	_, _ = fmt.Fprintln(out, "\nHooks:")
+	hookHosts := findHookHosts(cfg, host, host.Name)
+	if host.IsPattern() {
+		hookHosts = []*Host{host}
+	}
+	writeShowHooks(out, L, newConnectionHooks(hookHosts), newHookContext(cfg, host, host.Name, []string{}, ""))
+
+	entries := resolveSSHConfigSources(cfg, host)
+	_, _ = fmt.Fprintln(out, "\nSSH Config:")
+	t := newSimpleTableWriter(out)
+	t.AppendHeader(table.Row{"Keyword", "Defined In", "Value"})
+	for _, e := range entries {
+		t.AppendRow(table.Row{e.Keyword, e.Source, e.Value})
+	}
+	t.Render()
+
+	if !cmd.Bool("effective") {
+		return nil
+	}
+	if host.IsPattern() {
+		return fmt.Errorf("the effective ssh options can not be resolved for the pattern host: %s", host.Name)
+	}
+
+	sshConfigFile, removeSSHConfigFile, err := writeSSHConfigFile(cfg)
+	if err != nil {
+		return err
+	}
+	defer removeSSHConfigFile()
+
+	effective, err := runSSHG(sshConfigFile, host.Name)
+	if err != nil {
+		return err
+	}
+	defaults, err := runSSHG(os.DevNull, host.Name)
+	if err != nil {
+		return err
+	}
+
+	_, _ = fmt.Fprintln(out, "\nEffective SSH Config (ssh -G):")
+	t = newSimpleTableWriter(out)
+	t.AppendHeader(table.Row{"Keyword", "Source", "Value"})
+	for _, e := range diffSSHGOutput(effective, defaults, entries) {
+		t.AppendRow(table.Row{e.Keyword, e.Source, e.Value})
+	}
+	t.Render()
+	return nil
+}
+
+func writeShowHost(out io.Writer, h *Host) {
+	t := newSimpleTableWriter(out)
+	t.AppendRows([]table.Row{
+		{"Name:", h.Name},
+		{"Description:", h.Description},
+		{"Hidden:", fmt.Sprintf("%t", h.Hidden)},
+		{"Pattern:", fmt.Sprintf("%t", h.IsPattern())},
+		{"Tags:", strings.Join(h.Tags, ",")},
+		{"Extends:", strings.Join(h.Extends, ",")},
+	})
+	if h.Match != "" {
+		t.AppendRow(table.Row{"Match:", h.Match})
+	}
+	if len(h.Tunnels) > 0 {
+		t.AppendRow(table.Row{"Tunnels:", formatTunnels(h.Tunnels)})
+	}
+	t.Render()
+}
+
+// writeShowHooks outputs the hooks rendered as scripts.
+// The hooks defined as Lua functions are called with the hook context of a login to the host.
+func writeShowHooks(out io.Writer, L *lua.LState, hooks *connectionHooks, hookCtx *hookContext) {
+	for _, hook := range []struct {
+		name  string
+		hooks []any
+	}{
+		{"on_before_connect", hooks.OnBeforeConnect},
+		{"on_after_connect", hooks.OnAfterConnect},
+		{"on_after_disconnect", hooks.OnAfterDisconnect},
+		{"on_before_command", hooks.OnBeforeCommand},
+		{"on_after_command", hooks.OnAfterCommand},
+	} {
+		if len(hook.hooks) == 0 {
+			_, _ = fmt.Fprintf(out, "  %s: (none)\n", hook.name)
+			continue
+		}
+		_, _ = fmt.Fprintf(out, "  %s:\n", hook.name)
+		script, err := createHookScript(L, hook.hooks, hookCtx.toLuaTable(L))
+		if err != nil {
+			_, _ = fmt.Fprintf(out, "    (failed to render: %v)\n", err)
+			continue
+		}
+		for _, line := range strings.Split(script, "\n") {
+			_, _ = fmt.Fprintf(out, "    %s\n", line)
+		}
+	}
+}
+
+// sshConfigEntry is an ssh_config value with the place where it comes from.
+type sshConfigEntry struct {
+	Keyword string
+	Value   string
+	Source  string
+}
+
+// resolveSSHConfigSources returns the ssh_config values that apply to the host in the generated ssh_config,
+// with the names of the hosts that define them. Like ssh, the first value of each keyword wins.
+func resolveSSHConfigSources(cfg *Config, host *Host) []*sshConfigEntry {
+	hosts := []*Host{host}
+	if !host.IsPattern() {
+		hosts = findHookHosts(cfg, host, host.Name)
+	}
+
+	entries := make([]*sshConfigEntry, 0)
+	seen := map[string]bool{}
+	for _, h := range hosts {
+		for _, param := range h.SortedSSHConfig() {
+			for k, v := range param {
+				if seen[strings.ToLower(k)] {
+					continue
+				}
+				seen[strings.ToLower(k)] = true
+				entries = append(entries, &sshConfigEntry{Keyword: k, Value: v, Source: h.Name})
+			}
+		}
+	}
+	return entries
+}
+
+// runSSHG runs "ssh -G" with the ssh_config file and returns its output.
+func runSSHG(sshConfigFile string, hostname string) ([]byte, error) {
+	var stderr bytes.Buffer
+	eCmd := exec.Command("ssh", "-G", "-F", sshConfigFile, hostname)
+	eCmd.Stderr = &stderr
+	out, err := eCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run ssh -G: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// parseSSHGOutput parses the output of "ssh -G" into the keywords and their values.
+// A keyword that can be specified multiple times like "identityfile" has multiple values.
+func parseSSHGOutput(out []byte) ([]string, map[string][]string) {
+	keywords := make([]string, 0)
+	values := map[string][]string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		keyword, value, _ := strings.Cut(line, " ")
+		keyword = strings.ToLower(keyword)
+		if _, ok := values[keyword]; !ok {
+			keywords = append(keywords, keyword)
+		}
+		values[keyword] = append(values[keyword], value)
+	}
+	return keywords, values
+}
+
+// diffSSHGOutput compares the effective ssh options with the defaults and tells where each value comes from:
+//   - "xs (<host>)": the value is defined by the host in the config of XS.
+//   - "default": the value is the same as the default of ssh.
+//   - "ssh_config": the value is changed by the generated ssh_config in other ways, like Match sections.
+func diffSSHGOutput(effective []byte, defaults []byte, entries []*sshConfigEntry) []*sshConfigEntry {
+	keywords, values := parseSSHGOutput(effective)
+	_, defaultValues := parseSSHGOutput(defaults)
+
+	sources := map[string]string{}
+	for _, e := range entries {
+		sources[strings.ToLower(e.Keyword)] = e.Source
+	}
+
+	ret := make([]*sshConfigEntry, 0)
+	for _, keyword := range keywords {
+		source := "ssh_config"
+		if s, ok := sources[keyword]; ok {
+			source = "xs (" + s + ")"
+		} else if strings.Join(values[keyword], "\n") == strings.Join(defaultValues[keyword], "\n") {
+			source = "default"
+		}
+		for _, v := range values[keyword] {
+			ret = append(ret, &sshConfigEntry{Keyword: keyword, Value: v, Source: source})
+		}
+	}
+	return ret
+}
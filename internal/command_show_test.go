@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestResolveSSHConfigSources(t *testing.T) {
+	web1 := &Host{Name: "web1", SSHConfig: map[string]string{"HostName": "192.168.0.1", "Port": "2222"}}
+	all := &Host{Name: "*", SSHConfig: map[string]string{"port": "22", "User": "deploy"}}
+	db := &Host{Name: "db", SSHConfig: map[string]string{"User": "postgres"}}
+	cfg := &Config{Hosts: []*Host{all, web1, db}}
+
+	assert.Equal(t, []*sshConfigEntry{
+		{Keyword: "HostName", Value: "192.168.0.1", Source: "web1"},
+		{Keyword: "Port", Value: "2222", Source: "web1"},
+		{Keyword: "User", Value: "deploy", Source: "*"},
+	}, resolveSSHConfigSources(cfg, web1))
+
+	assert.Equal(t, []*sshConfigEntry{
+		{Keyword: "User", Value: "deploy", Source: "*"},
+		{Keyword: "port", Value: "22", Source: "*"},
+	}, resolveSSHConfigSources(cfg, all))
+}
+
+func TestDiffSSHGOutput(t *testing.T) {
+	effective := []byte(`host web1
+user deploy
+hostname 192.168.0.1
+port 22
+compression yes
+identityfile ~/.ssh/id_rsa
+identityfile ~/.ssh/id_ed25519
+`)
+	defaults := []byte(`host web1
+user root
+hostname web1
+port 22
+compression no
+identityfile ~/.ssh/id_rsa
+identityfile ~/.ssh/id_ed25519
+`)
+	entries := []*sshConfigEntry{
+		{Keyword: "HostName", Value: "192.168.0.1", Source: "web1"},
+		{Keyword: "User", Value: "deploy", Source: "*"},
+	}
+
+	assert.Equal(t, []*sshConfigEntry{
+		{Keyword: "host", Value: "web1", Source: "default"},
+		{Keyword: "user", Value: "deploy", Source: "xs (*)"},
+		{Keyword: "hostname", Value: "192.168.0.1", Source: "xs (web1)"},
+		{Keyword: "port", Value: "22", Source: "default"},
+		{Keyword: "compression", Value: "yes", Source: "ssh_config"},
+		{Keyword: "identityfile", Value: "~/.ssh/id_rsa", Source: "default"},
+		{Keyword: "identityfile", Value: "~/.ssh/id_ed25519", Source: "default"},
+	}, diffSSHGOutput(effective, defaults, entries))
+}
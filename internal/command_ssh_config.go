@@ -2,6 +2,7 @@ package internal
 
 import (
 	"context"
+	"fmt"
 	"github.com/kohkimakimoto/xs/internal/debuglogger"
 	"github.com/urfave/cli/v3"
 )
@@ -17,7 +18,13 @@ var SSHConfigCommand = &cli.Command{
 		return ctx, nil
 	},
 	Action: sshConfigAction,
-	Flags:  []cli.Flag{},
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "write",
+			Aliases: []string{"w"},
+			Usage:   "Write ssh_config to the `path` instead of STDOUT (replaced atomically with the permission 0600)",
+		},
+	},
 }
 
 func sshConfigAction(ctx context.Context, cmd *cli.Command) error {
@@ -31,6 +38,13 @@ func sshConfigAction(ctx context.Context, cmd *cli.Command) error {
 	if err != nil {
 		return err
 	}
+	if path := cmd.String("write"); path != "" {
+		if err := writeFileAtomic(path, sshConfigContent, 0600); err != nil {
+			return fmt.Errorf("failed to write ssh_config: %w", err)
+		}
+		_, _ = fmt.Fprintf(cmd.ErrWriter, "Wrote ssh_config to %s\n", path)
+		return nil
+	}
 	if _, err := cmd.Writer.Write(sshConfigContent); err != nil {
 		return err
 	}
@@ -0,0 +1,256 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"github.com/Songmu/wrapcommander"
+	"github.com/kohkimakimoto/xs/internal/debuglogger"
+	"github.com/kohkimakimoto/xs/internal/lualib/shell"
+	"github.com/urfave/cli/v3"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+var ScpCommand = &cli.Command{
+	Name:               "scp",
+	Usage:              "Run scp with the ssh_config generated by xs",
+	ArgsUsage:          "[scp options ...] source ... target",
+	SkipFlagParsing:    true,
+	CustomHelpTemplate: helpTemplate,
+	Action:             transferAction("scp"),
+}
+
+var SftpCommand = &cli.Command{
+	Name:               "sftp",
+	Usage:              "Run sftp with the ssh_config generated by xs",
+	ArgsUsage:          "[sftp options ...] destination",
+	SkipFlagParsing:    true,
+	CustomHelpTemplate: helpTemplate,
+	Action:             transferAction("sftp"),
+}
+
+var RsyncCommand = &cli.Command{
+	Name:               "rsync",
+	Usage:              "Run rsync over ssh with the ssh_config generated by xs",
+	ArgsUsage:          "[rsync options ...] source ... target",
+	SkipFlagParsing:    true,
+	CustomHelpTemplate: helpTemplate,
+	Action:             transferAction("rsync"),
+}
+
+// transferOptionsWithValue is the list of options that require values for each transfer program.
+// It is used to distinguish the operands from the option values.
+var transferOptionsWithValue = map[string][]string{
+	"scp":  {"-c", "-D", "-F", "-i", "-J", "-l", "-o", "-P", "-S", "-X"},
+	"sftp": {"-B", "-b", "-c", "-D", "-F", "-i", "-J", "-l", "-o", "-P", "-R", "-S", "-s", "-X"},
+	"rsync": {
+		"-e", "-f", "-B", "-M", "-T",
+		"--rsh", "--rsync-path", "--filter", "--exclude", "--include", "--exclude-from", "--include-from",
+		"--files-from", "--temp-dir", "--partial-dir", "--compare-dest", "--copy-dest", "--link-dest",
+		"--backup-dir", "--suffix", "--chmod", "--chown", "--usermap", "--groupmap", "--log-file",
+		"--log-file-format", "--out-format", "--password-file", "--timeout", "--contimeout", "--port",
+		"--bwlimit", "--max-size", "--min-size", "--max-delete", "--block-size", "--sockopts",
+	},
+}
+
+func transferAction(program string) cli.ActionFunc {
+	return func(ctx context.Context, cmd *cli.Command) error {
+		logger := debuglogger.Get(cmd)
+
+		args := cmd.Args().Slice()
+		if len(args) == 0 {
+			return cli.ShowSubcommandHelp(cmd)
+		}
+		if program != "rsync" && slices.ContainsFunc(args, func(arg string) bool { return strings.HasPrefix(arg, "-F") }) {
+			return fmt.Errorf("-F option can not be used because xs specifies the generated ssh_config")
+		}
+
+		cfg, L, err := newConfig(cmd)
+		if err != nil {
+			return err
+		}
+		defer L.Close()
+
+		sshConfigFile, removeSSHConfigFile, err := writeSSHConfigFile(cfg)
+		if err != nil {
+			return err
+		}
+		defer removeSSHConfigFile()
+
+		logger.Printf("generated ssh config file: %s", sshConfigFile)
+
+		var programArgs []string
+		if program == "rsync" {
+			programArgs, err = rewriteRsyncRemoteShell(args, sshConfigFile)
+			if err != nil {
+				return err
+			}
+		} else {
+			programArgs = append([]string{"-F", sshConfigFile}, args...)
+		}
+
+		// Run the on_before_command and on_after_command hooks of the hosts in the operands.
+		command := program + " " + strings.Join(args, " ")
+		hookCtxs := make([]*hookContext, 0)
+		hooksList := make([]*connectionHooks, 0)
+		for _, destination := range extractTransferDestinations(program, args) {
+			hostname := extractHostname(destination)
+			host := cfg.NewHostFilter().ExcludePatterns().GetHostByName(hostname)
+			hooks := newConnectionHooks(findHookHosts(cfg, host, hostname))
+			hookCtx := newHookContext(cfg, host, destination, []string{}, command)
+			if len(hooks.OnBeforeCommand) > 0 {
+				if err := runLocalHooks(cmd, L, "on_before_command", hooks.OnBeforeCommand, hookCtx); err != nil {
+					return err
+				}
+			}
+			hookCtxs = append(hookCtxs, hookCtx)
+			hooksList = append(hooksList, hooks)
+		}
+
+		eCmd := exec.Command(program, programArgs...)
+		eCmd.Stdin = os.Stdin
+		eCmd.Stdout = os.Stdout
+		eCmd.Stderr = os.Stderr
+
+		logger.Printf("underlying %s command: %v", program, eCmd.Args)
+
+		startTime := time.Now()
+		if err = eCmd.Run(); err != nil {
+			err = cli.Exit(err, wrapcommander.ResolveExitCode(err))
+		}
+		duration := time.Since(startTime)
+
+		for i, hooks := range hooksList {
+			hookCtxs[i].setResult(err, duration)
+			if len(hooks.OnAfterCommand) > 0 {
+				if hookErr := runLocalHooks(cmd, L, "on_after_command", hooks.OnAfterCommand, hookCtxs[i]); hookErr != nil {
+					_, _ = fmt.Fprintf(cmd.ErrWriter, "failed to run on_after_command: %v\n", hookErr)
+				}
+			}
+		}
+		return err
+	}
+}
+
+// extractTransferDestinations returns the remote destinations like "user@host" in the operands without duplicates.
+// The remote operands are in the form of "[user@]host:path" or "scp://[user@]host[:port]/path".
+// For sftp, the first operand is always the destination.
+func extractTransferDestinations(program string, args []string) []string {
+	destinations := make([]string, 0)
+	add := func(destination string) {
+		if destination != "" && !slices.Contains(destinations, destination) {
+			destinations = append(destinations, destination)
+		}
+	}
+
+	operands := extractTransferOperands(program, args)
+	for i, operand := range operands {
+		if program == "sftp" {
+			if i == 0 {
+				var destination string
+				if rest, ok := strings.CutPrefix(operand, "sftp://"); ok {
+					destination, _, _ = strings.Cut(rest, "/")
+				} else {
+					destination, _, _ = strings.Cut(operand, ":")
+				}
+				add(destination)
+			}
+			continue
+		}
+		if rest, ok := strings.CutPrefix(operand, "scp://"); ok {
+			destination, _, _ := strings.Cut(rest, "/")
+			add(destination)
+			continue
+		}
+		destination, _, ok := strings.Cut(operand, ":")
+		if !ok || strings.Contains(destination, "/") {
+			// local path
+			continue
+		}
+		if program == "rsync" && strings.Contains(operand, "::") {
+			// rsync daemon
+			continue
+		}
+		add(destination)
+	}
+	return destinations
+}
+
+// extractTransferOperands returns the operands skipping options and their values.
+func extractTransferOperands(program string, args []string) []string {
+	operands := make([]string, 0)
+	optionsWithValue := transferOptionsWithValue[program]
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			operands = append(operands, args[i+1:]...)
+			break
+		}
+		if strings.HasPrefix(arg, "-") && arg != "-" {
+			if slices.Contains(optionsWithValue, arg) {
+				i++
+			}
+			continue
+		}
+		operands = append(operands, arg)
+	}
+	return operands
+}
+
+// rewriteRsyncRemoteShell adds the -F option with the ssh_config file to the remote shell of rsync.
+// If the remote shell is specified by -e, --rsh or RSYNC_RSH, the -F option is inserted after the program name.
+// Otherwise, "-e 'ssh -F <file>'" is added. The file is quoted because rsync splits the remote shell by spaces.
+func rewriteRsyncRemoteShell(args []string, sshConfigFile string) ([]string, error) {
+	rewrite := func(rsh string) (string, error) {
+		fields := strings.Fields(rsh)
+		if len(fields) == 0 {
+			fields = []string{"ssh"}
+		}
+		if slices.ContainsFunc(fields[1:], func(f string) bool { return strings.HasPrefix(f, "-F") }) {
+			return "", fmt.Errorf("-F option in the remote shell can not be used because xs specifies the generated ssh_config")
+		}
+		return fields[0] + " -F " + shell.Quote(sshConfigFile) + strings.TrimPrefix(strings.TrimSpace(rsh), fields[0]), nil
+	}
+
+	rewritten := make([]string, 0, len(args)+2)
+	found := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rewritten = append(rewritten, args[i:]...)
+			break
+		}
+		if (arg == "-e" || arg == "--rsh") && i+1 < len(args) {
+			rsh, err := rewrite(args[i+1])
+			if err != nil {
+				return nil, err
+			}
+			rewritten = append(rewritten, arg, rsh)
+			found = true
+			i++
+			continue
+		}
+		if value, ok := strings.CutPrefix(arg, "--rsh="); ok {
+			rsh, err := rewrite(value)
+			if err != nil {
+				return nil, err
+			}
+			rewritten = append(rewritten, "--rsh="+rsh)
+			found = true
+			continue
+		}
+		rewritten = append(rewritten, arg)
+	}
+
+	if !found {
+		rsh, err := rewrite(os.Getenv("RSYNC_RSH"))
+		if err != nil {
+			return nil, err
+		}
+		rewritten = append([]string{"-e", rsh}, rewritten...)
+	}
+	return rewritten, nil
+}
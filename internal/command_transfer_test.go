@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExtractTransferDestinations(t *testing.T) {
+	testCases := []struct {
+		program  string
+		args     []string
+		expected []string
+	}{
+		{program: "scp", args: []string{"file.txt", "web1:/tmp/"}, expected: []string{"web1"}},
+		{program: "scp", args: []string{"-P", "2222", "user@web1:/tmp/a", "web2:/tmp/b", "web1:/tmp/c"}, expected: []string{"user@web1", "web2", "web1"}},
+		{program: "scp", args: []string{"-i", "key:file", "./dir:name/file", "scp://web1:2222/tmp/"}, expected: []string{"web1:2222"}},
+		{program: "sftp", args: []string{"-P", "2222", "web1"}, expected: []string{"web1"}},
+		{program: "sftp", args: []string{"user@web1:/tmp"}, expected: []string{"user@web1"}},
+		{program: "sftp", args: []string{"sftp://user@web1:2222/tmp"}, expected: []string{"user@web1:2222"}},
+		{program: "rsync", args: []string{"-avz", "--exclude", "a:b", "./src/", "web1:/srv/"}, expected: []string{"web1"}},
+		{program: "rsync", args: []string{"-av", "web1::module/path", "./dst/"}, expected: []string{}},
+	}
+
+	for _, testCase := range testCases {
+		actual := extractTransferDestinations(testCase.program, testCase.args)
+		assert.Equal(t, testCase.expected, actual, testCase.args)
+	}
+}
+
+func TestRewriteRsyncRemoteShell(t *testing.T) {
+	t.Setenv("RSYNC_RSH", "")
+
+	args, err := rewriteRsyncRemoteShell([]string{"-av", "src/", "web1:/dst/"}, "/tmp/ssh_config")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-e", "ssh -F /tmp/ssh_config", "-av", "src/", "web1:/dst/"}, args)
+
+	args, err = rewriteRsyncRemoteShell([]string{"-av", "-e", "ssh -i ~/.ssh/key", "src/", "web1:/dst/"}, "/tmp/ssh_config")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-av", "-e", "ssh -F /tmp/ssh_config -i ~/.ssh/key", "src/", "web1:/dst/"}, args)
+
+	args, err = rewriteRsyncRemoteShell([]string{"--rsh=ssh -p 2222", "src/", "web1:/dst/"}, "/tmp/ssh_config")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"--rsh=ssh -F /tmp/ssh_config -p 2222", "src/", "web1:/dst/"}, args)
+
+	t.Setenv("RSYNC_RSH", "ssh -C")
+	args, err = rewriteRsyncRemoteShell([]string{"src/", "web1:/dst/"}, "/tmp/ssh_config")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-e", "ssh -F /tmp/ssh_config -C", "src/", "web1:/dst/"}, args)
+
+	args, err = rewriteRsyncRemoteShell([]string{"src/", "web1:/dst/"}, "/home/my user/.xs/ssh_config")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-e", "ssh -F '/home/my user/.xs/ssh_config' -C", "src/", "web1:/dst/"}, args)
+
+	_, err = rewriteRsyncRemoteShell([]string{"-e", "ssh -F other", "src/", "web1:/dst/"}, "/tmp/ssh_config")
+	assert.Error(t, err)
+}
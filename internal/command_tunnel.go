@@ -0,0 +1,280 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/kohkimakimoto/xs/internal/debuglogger"
+	"github.com/urfave/cli/v3"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+var TunnelCommand = &cli.Command{
+	Name:                   "tunnel",
+	Usage:                  "Manage the background tunnels defined by the tunnels parameter",
+	UseShortOptionHandling: true,
+	Action: func(ctx context.Context, cmd *cli.Command) error {
+		return cli.ShowSubcommandHelp(cmd)
+	},
+	Commands: []*cli.Command{
+		{
+			Name:                   "up",
+			Usage:                  "Start the tunnels of the hosts in the background",
+			ArgsUsage:              "<host> [host ...]",
+			UseShortOptionHandling: true,
+			CustomHelpTemplate:     helpTemplate,
+			Action:                 tunnelUpAction,
+		},
+		{
+			Name:                   "down",
+			Usage:                  "Stop the tunnels of the hosts",
+			ArgsUsage:              "<host> [host ...]",
+			UseShortOptionHandling: true,
+			CustomHelpTemplate:     helpTemplate,
+			Action:                 tunnelDownAction,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:    "all",
+					Aliases: []string{"a"},
+					Usage:   "Stop the tunnels of all the hosts",
+				},
+			},
+		},
+		{
+			Name:                   "status",
+			Usage:                  "Show the status of the tunnels",
+			ArgsUsage:              "[host ...]",
+			UseShortOptionHandling: true,
+			CustomHelpTemplate:     helpTemplate,
+			Action:                 tunnelStatusAction,
+		},
+	},
+}
+
+func tunnelUpAction(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Args().Len() == 0 {
+		return cli.ShowSubcommandHelp(cmd)
+	}
+
+	cfg, L, err := newConfig(cmd)
+	if err != nil {
+		return err
+	}
+	defer L.Close()
+
+	for _, name := range cmd.Args().Slice() {
+		if err := tunnelUp(cmd, cfg, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tunnelUp starts the ssh command in the background as a ControlMaster with the port forwardings of the host.
+// The control socket and the state are stored in ~/.xs/tunnels, so that the other commands can check and stop it.
+func tunnelUp(cmd *cli.Command, cfg *Config, name string) error {
+	logger := debuglogger.Get(cmd)
+
+	host := cfg.NewHostFilter().ExcludePatterns().GetHostByName(name)
+	if host == nil {
+		return fmt.Errorf("host not found: %s", name)
+	}
+	if len(host.Tunnels) == 0 {
+		return fmt.Errorf("host %s has no tunnels", name)
+	}
+
+	s, err := readTunnelState(name)
+	if err != nil {
+		return err
+	}
+	if s != nil {
+		if _, err := runTunnelControl(s.Socket, name, "check"); err == nil {
+			_, _ = fmt.Fprintf(cmd.Writer, "%s: tunnels are already up (pid %d)\n", name, s.Pid)
+			return nil
+		}
+		// The ssh process has exited without "xs tunnel down".
+		logger.Printf("remove the stale tunnel state of %s", name)
+		removeTunnelState(name)
+	}
+
+	if err := os.MkdirAll(getTunnelStateDir(), 0700); err != nil {
+		return err
+	}
+
+	sshConfigFile, removeSSHConfigFile, err := writeSSHConfigFile(cfg)
+	if err != nil {
+		return err
+	}
+	defer removeSSHConfigFile()
+
+	socket := tunnelSocketFile(name)
+	eCmd := exec.Command("ssh", tunnelSSHArgs(sshConfigFile, socket, host)...)
+	eCmd.Stdin = os.Stdin
+	eCmd.Stdout = os.Stdout
+	eCmd.Stderr = os.Stderr
+
+	logger.Printf("underlying ssh command: %v", eCmd.Args)
+
+	// "-f" makes ssh go to the background after the authentication and the forwardings are established.
+	if err := eCmd.Run(); err != nil {
+		return fmt.Errorf("failed to start the tunnels of %s: %w", name, err)
+	}
+
+	out, err := runTunnelControl(socket, name, "check")
+	if err != nil {
+		return fmt.Errorf("failed to check the tunnels of %s: %w", name, err)
+	}
+	pid, _ := parseMasterPid(out)
+
+	s = &tunnelState{
+		Host:      name,
+		Pid:       pid,
+		Socket:    socket,
+		Tunnels:   host.Tunnels,
+		StartedAt: time.Now(),
+	}
+	if err := writeTunnelState(s); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(cmd.Writer, "%s: tunnels are up (pid %d): %s\n", name, pid, formatTunnels(host.Tunnels))
+	return nil
+}
+
+// tunnelSSHArgs returns the arguments of the ssh command that starts the tunnels of the host.
+func tunnelSSHArgs(sshConfigFile string, socket string, host *Host) []string {
+	args := []string{
+		"-F", sshConfigFile,
+		"-f", "-N",
+		"-M", "-S", socket,
+		"-o", "ControlPersist=no",
+		"-o", "ExitOnForwardFailure=yes",
+	}
+	for _, t := range host.Tunnels {
+		args = append(args, "-L", t.forwardSpec())
+	}
+	return append(args, host.Name)
+}
+
+func tunnelDownAction(ctx context.Context, cmd *cli.Command) error {
+	names := cmd.Args().Slice()
+	if cmd.Bool("all") {
+		states, err := readAllTunnelStates()
+		if err != nil {
+			return err
+		}
+		names = names[:0]
+		for _, s := range states {
+			names = append(names, s.Host)
+		}
+	} else if len(names) == 0 {
+		return cli.ShowSubcommandHelp(cmd)
+	}
+
+	for _, name := range names {
+		if err := tunnelDown(cmd, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tunnelDown stops the ssh process of the tunnels by "ssh -O exit".
+// If the process does not respond, it has already exited, and only the state is removed.
+// The process is never signaled by the recorded pid, because the pid may have been reused by another process.
+func tunnelDown(cmd *cli.Command, name string) error {
+	logger := debuglogger.Get(cmd)
+
+	s, err := readTunnelState(name)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		return fmt.Errorf("tunnels of %s are not up", name)
+	}
+
+	if _, err := runTunnelControl(s.Socket, name, "exit"); err != nil {
+		logger.Printf("failed to stop the tunnels of %s by the control socket: %v", name, err)
+	}
+	removeTunnelState(name)
+	_, _ = fmt.Fprintf(cmd.Writer, "%s: tunnels are down\n", name)
+	return nil
+}
+
+func tunnelStatusAction(ctx context.Context, cmd *cli.Command) error {
+	var states []*tunnelState
+	if cmd.Args().Present() {
+		for _, name := range cmd.Args().Slice() {
+			s, err := readTunnelState(name)
+			if err != nil {
+				return err
+			}
+			if s == nil {
+				s = &tunnelState{Host: name}
+			}
+			states = append(states, s)
+		}
+	} else {
+		var err error
+		if states, err = readAllTunnelStates(); err != nil {
+			return err
+		}
+		if len(states) == 0 {
+			_, _ = fmt.Fprintln(cmd.Writer, "No tunnels are up")
+			return nil
+		}
+	}
+
+	t := newSimpleTableWriter(cmd.Writer)
+	t.AppendHeader(table.Row{"Host", "Status", "PID", "Started", "Tunnels"})
+	for _, s := range states {
+		t.AppendRow(tunnelStatusRow(s))
+	}
+	t.Render()
+	return nil
+}
+
+// tunnelStatusRow returns the row of the status table. The status is "up" if the ssh process responds,
+// "dead" if it has exited without "xs tunnel down", and "down" if the tunnels are not started.
+// Each tunnel is followed by whether its local port accepts connections.
+func tunnelStatusRow(s *tunnelState) table.Row {
+	if s.Socket == "" {
+		return table.Row{s.Host, "down", "-", "-", "-"}
+	}
+
+	status := "up"
+	if _, err := runTunnelControl(s.Socket, s.Host, "check"); err != nil {
+		status = "dead"
+	}
+	tunnels := make([]string, 0, len(s.Tunnels))
+	for _, t := range s.Tunnels {
+		health := "closed"
+		if status == "up" && checkTunnel(t) {
+			health = "ok"
+		}
+		tunnels = append(tunnels, fmt.Sprintf("%s (%s)", t, health))
+	}
+	return table.Row{s.Host, status, s.Pid, s.StartedAt.Local().Format(time.DateTime), strings.Join(tunnels, ", ")}
+}
+
+// runTunnelControl sends the control command like "check" or "exit" to the ssh process of the tunnels.
+func runTunnelControl(socket string, host string, command string) (string, error) {
+	// The config files are not needed because the master process is found by the socket.
+	return runSSHControl(command, "-F", os.DevNull, "-S", socket, host)
+}
+
+// runSSHControl sends the control command like "check" or "exit" to the ssh master process by "ssh -O".
+// The args are the options of the ssh command and the host. It returns the output of the ssh command.
+func runSSHControl(command string, args ...string) (string, error) {
+	out, err := exec.Command("ssh", append([]string{"-O", command}, args...)...).CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if err != nil {
+		if output != "" {
+			return output, fmt.Errorf("%w: %s", err, output)
+		}
+		return output, err
+	}
+	return output, nil
+}
@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/kohkimakimoto/xs/internal/debuglogger"
+	"github.com/kohkimakimoto/xs/internal/lualib/shell"
+	"github.com/urfave/cli/v3"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// newCompletionCommand returns the command that outputs the completion script of the shell.
+// The script is rendered from the template with the path of the executable and the builtin commands of the app,
+// and the command outputs the hosts for the script with the --hosts flag.
+func newCompletionCommand(shellName string, tmpl *template.Template) *cli.Command {
+	return &cli.Command{
+		Name:                   shellName + "-completion",
+		Usage:                  "Output " + shellName + " completion script to STDOUT",
+		UseShortOptionHandling: true,
+		CustomHelpTemplate:     helpTemplate,
+		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+			// Disable debug output because it will break the completion script.
+			debuglogger.Get(cmd).IsDebug = false
+			return ctx, nil
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if cmd.Bool("hosts") {
+				return printCompletionHosts(ctx, cmd)
+			} else {
+				return printCompletionScript(ctx, cmd, tmpl)
+			}
+		},
+		Flags: []cli.Flag{
+			&cli.BoolFlag{Name: "hosts"},
+		},
+	}
+}
+
+// completionTemplateFuncs are the functions to quote the values in the completion script templates.
+var completionTemplateFuncs = template.FuncMap{
+	"quote":     shell.Quote,
+	"fishQuote": fishQuote,
+}
+
+// fishQuote quotes the string with single quotes for fish, which only escapes single quotes and backslashes in them.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+func printCompletionScript(ctx context.Context, cmd *cli.Command, tmpl *template.Template) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	dict := map[string]interface{}{
+		"Executable": executable,
+		"Commands":   completionCommands(cmd),
+	}
+
+	var b bytes.Buffer
+	err = tmpl.Execute(&b, dict)
+	if err != nil {
+		return err
+	}
+
+	if _, err := cmd.Writer.Write(b.Bytes()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// printCompletionHosts outputs the hosts for shell completion.
+// Each line is a host name and its description separated by a tab.
+func printCompletionHosts(ctx context.Context, cmd *cli.Command) error {
+	hosts, err := loadHostsForListing(cmd, false)
+	if err != nil {
+		return err
+	}
+
+	f := &HostFilter{hosts: hosts}
+	hosts = f.ExcludeHidden().ExcludePatterns().GetHosts()
+	for _, h := range hosts {
+		_, _ = fmt.Fprintf(cmd.Writer, "%s\t%s\n", h.Name, h.Description)
+	}
+	return nil
+}
+
+type completionCommand struct {
+	Name  string
+	Usage string
+}
+
+// completionCommands returns the builtin commands including aliases for shell completion.
+// They are generated from the commands of the app, so the completion scripts of all the shells list the same commands.
+func completionCommands(cmd *cli.Command) []*completionCommand {
+	commands := make([]*completionCommand, 0)
+	for _, c := range cmd.Root().VisibleCommands() {
+		if c.Name == "help" {
+			continue
+		}
+		for _, name := range append([]string{c.Name}, c.Aliases...) {
+			commands = append(commands, &completionCommand{Name: name, Usage: c.Usage})
+		}
+	}
+	return commands
+}
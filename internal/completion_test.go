@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"github.com/kohkimakimoto/xs/internal/debuglogger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+	"io"
+	"testing"
+	"text/template"
+)
+
+func TestCompletionCommands(t *testing.T) {
+	root := &cli.Command{
+		Name: "xs",
+		Commands: []*cli.Command{
+			{Name: "list", Aliases: []string{"ls"}, Usage: "List defined hosts"},
+			{Name: "secret", Usage: "Hidden command", Hidden: true},
+			{Name: "zsh-completion", Usage: "Output zsh completion script to STDOUT"},
+		},
+	}
+	root.Commands = append(root.Commands, &cli.Command{Name: "help", Usage: "Shows a list of commands"})
+
+	assert.Equal(t, []*completionCommand{
+		{Name: "list", Usage: "List defined hosts"},
+		{Name: "ls", Usage: "List defined hosts"},
+		{Name: "zsh-completion", Usage: "Output zsh completion script to STDOUT"},
+	}, completionCommands(root))
+}
+
+func TestCompletionScripts(t *testing.T) {
+	testCases := []struct {
+		shell    string
+		tmpl     *template.Template
+		expected []string
+	}{
+		{
+			shell: "zsh",
+			tmpl:  zshTmpl,
+			expected: []string{
+				"    'list:List defined hosts'\n    'ls:List defined hosts'\n",
+				"    'show:Show the '\\''details'\\'' of a host'\n    'zsh-completion:Output zsh completion script to STDOUT'\n  )",
+			},
+		},
+		{
+			shell: "bash",
+			tmpl:  bashTmpl,
+			expected: []string{
+				`local builtin_commands="list ls show bash-completion "`,
+			},
+		},
+		{
+			shell: "fish",
+			tmpl:  fishTmpl,
+			expected: []string{
+				"-a 'list' -d 'List defined hosts'\n",
+				"-a 'ls' -d 'List defined hosts'\n",
+				`-a 'show' -d 'Show the \'details\' of a host'` + "\n",
+				"-a 'fish-completion' -d 'Output fish completion script to STDOUT'\n",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.shell, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			completion := newCompletionCommand(tc.shell, tc.tmpl)
+			completion.Writer = out
+			root := &cli.Command{
+				Name: "xs",
+				Commands: []*cli.Command{
+					{Name: "list", Aliases: []string{"ls"}, Usage: "List defined hosts"},
+					{Name: "show", Usage: "Show the 'details' of a host"},
+				},
+				Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+					debuglogger.Bind(cmd, debuglogger.New(io.Discard, false, true))
+					return ctx, nil
+				},
+			}
+			root.Commands = append(root.Commands, completion)
+
+			err := root.Run(context.Background(), []string{"xs", tc.shell + "-completion"})
+			require.NoError(t, err)
+			for _, expected := range tc.expected {
+				assert.Contains(t, out.String(), expected)
+			}
+		})
+	}
+}
@@ -1,21 +1,49 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
 	"github.com/kohkimakimoto/xs/internal/debuglogger"
 	luadebuglogger "github.com/kohkimakimoto/xs/internal/lualib/debuglogger"
+	"github.com/kohkimakimoto/xs/internal/lualib/inventory"
+	luajson "github.com/kohkimakimoto/xs/internal/lualib/json"
 	"github.com/kohkimakimoto/xs/internal/lualib/shell"
 	"github.com/kohkimakimoto/xs/internal/lualib/template"
+	luayaml "github.com/kohkimakimoto/xs/internal/lualib/yaml"
 	"github.com/urfave/cli/v3"
 	"github.com/yuin/gopher-lua"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	Filepath    string
-	Hosts       []*Host
-	DebugLogger *debuglogger.Logger
+	// Filepath is the path of the first config file.
+	Filepath string
+	// Filepaths is the paths of all the config files in the order of loading.
+	Filepaths []string
+	Hosts     []*Host
+	Templates []*Host
+	Issues    []*ConfigIssue
+	// SSHConfigIncludes is the list of the ssh_config files included by include_ssh_config.
+	SSHConfigIncludes []string
+	DebugLogger       *debuglogger.Logger
+	// Multiplex is the settings of the connection multiplexing set by xs.multiplex. It is nil if it is disabled.
+	Multiplex *Multiplex
+	// StableSSHConfig is whether the generated ssh_config is written to the stable path set by xs.stable_ssh_config.
+	StableSSHConfig bool
+	// loadingFile is the path of the config file being loaded.
+	loadingFile string
+	// dependencies is the files other than the config files that the hosts depend on, for the cache.
+	dependencies []string
+	// cacheTTL is the time to live of the cache set implicitly by the dynamic sources like xs.shell.
+	cacheTTL    time.Duration
+	cacheTTLSet bool
+	// explicitCacheTTL is the time to live of the cache set by xs.cache_ttl. It takes precedence over cacheTTL.
+	explicitCacheTTL    time.Duration
+	explicitCacheTTLSet bool
 }
 
 func (cfg *Config) NewHostFilter() *HostFilter {
@@ -25,21 +53,62 @@ func (cfg *Config) NewHostFilter() *HostFilter {
 }
 
 func (cfg *Config) AddHost(h *Host) error {
-	for _, host := range cfg.Hosts {
+	for i, host := range cfg.Hosts {
 		if host.Name == h.Name {
-			return fmt.Errorf("host %s already registered", h.Name)
+			if !cfg.canRedefine(host, h) {
+				return fmt.Errorf("host %s already registered", h.Name)
+			}
+			cfg.logRedefinition("host", host, h)
+			cfg.Hosts[i] = h
+			return nil
 		}
 	}
 	cfg.Hosts = append(cfg.Hosts, h)
 	return nil
 }
 
+func (cfg *Config) AddTemplate(t *Host) error {
+	for i, template := range cfg.Templates {
+		if template.Name == t.Name {
+			if !cfg.canRedefine(template, t) {
+				return fmt.Errorf("host template %s already registered", t.Name)
+			}
+			cfg.logRedefinition("host template", template, t)
+			cfg.Templates[i] = t
+			return nil
+		}
+	}
+	cfg.Templates = append(cfg.Templates, t)
+	return nil
+}
+
+// canRedefine reports whether the host can be replaced by the new one. It is allowed only across the config files.
+func (cfg *Config) canRedefine(h *Host, newHost *Host) bool {
+	return h.file != "" && newHost.file != "" && h.file != newHost.file
+}
+
+func (cfg *Config) logRedefinition(kind string, h *Host, newHost *Host) {
+	if cfg.DebugLogger != nil {
+		cfg.DebugLogger.Printf("%s %s defined in %s is redefined in %s", kind, h.Name, h.file, newHost.file)
+	}
+}
+
+func (cfg *Config) GetTemplateByName(name string) *Host {
+	for _, t := range cfg.Templates {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
 const LuaConfigKey = "*__xs_config"
 
 // registerConfig registers the config object in the Lua state.
 func registerConfig(L *lua.LState) {
 	config := &Config{
-		Hosts: []*Host{},
+		Hosts:     []*Host{},
+		Templates: []*Host{},
 	}
 	ud := L.NewUserData()
 	ud.Value = config
@@ -66,7 +135,9 @@ func newLState() *lua.LState {
 	L := lua.NewState()
 
 	// define built-in functions
-	L.SetGlobal("host", L.NewFunction(xsHostFunc))
+	L.SetGlobal("host", newLuaHostFunctions(L))
+	L.SetGlobal("host_template", L.NewFunction(xsHostTemplateFunc))
+	L.SetGlobal("include_ssh_config", L.NewFunction(xsIncludeSSHConfigFunc))
 
 	// register config object
 	registerConfig(L)
@@ -83,55 +154,158 @@ type ConfigLoadError struct {
 }
 
 func (e *ConfigLoadError) Error() string {
-	return "failed to load config (" + e.Err.Error() + ")"
+	return "failed to load config " + e.Path + " (" + e.Err.Error() + ")"
+}
+
+func (e *ConfigLoadError) Unwrap() error {
+	return e.Err
 }
 
 func newConfig(cmd *cli.Command) (*Config, *lua.LState, error) {
-	configFilePath := getConfigFilePath()
-	if absPath, err := filepath.Abs(configFilePath); err == nil {
-		configFilePath = absPath
+	paths, explicit := getConfigFilePaths()
+	files, err := resolveConfigFiles(paths, explicit)
+	if err != nil {
+		return nil, nil, err
 	}
-	if _, err := os.Stat(configFilePath); os.IsNotExist(err) {
-		return nil, nil, &ConfigLoadError{Err: fmt.Errorf("no config file: %s", configFilePath), Path: configFilePath}
+	return loadConfig(files, debuglogger.Get(cmd))
+}
+
+// resolveConfigFiles returns the config files to load from the paths.
+// A directory path is expanded to the "*.lua" files in it in sorted order. A file loaded twice is skipped.
+// If the paths are not specified explicitly, the paths that do not exist are skipped
+// as long as at least one config file is found.
+func resolveConfigFiles(paths []string, explicit bool) ([]string, error) {
+	files := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if absPath, err := filepath.Abs(path); err == nil {
+			path = absPath
+		}
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			if explicit {
+				return nil, &ConfigLoadError{Err: errors.New("no config file"), Path: path}
+			}
+			continue
+		} else if err != nil {
+			return nil, &ConfigLoadError{Err: err, Path: path}
+		}
+
+		matches := []string{path}
+		if info.IsDir() {
+			// filepath.Glob returns the files in lexical order
+			if matches, err = filepath.Glob(filepath.Join(path, "*.lua")); err != nil {
+				return nil, &ConfigLoadError{Err: err, Path: path}
+			}
+		}
+		for _, file := range matches {
+			if !slices.Contains(files, file) {
+				files = append(files, file)
+			}
+		}
 	}
+	if len(files) == 0 {
+		path := ""
+		if len(paths) > 0 {
+			path = paths[0]
+		}
+		return nil, &ConfigLoadError{Err: errors.New("no config file"), Path: path}
+	}
+	return files, nil
+}
 
+// loadConfig loads the config files in order into a config.
+// A host or a host template defined in a file can be redefined in the later files,
+// and the later definition replaces the earlier one in place. Redefining it in the same file is an error.
+func loadConfig(files []string, logger *debuglogger.Logger) (*Config, *lua.LState, error) {
 	// Create Lua state that corresponds to the config.
 	L := newLState()
 
 	// Get config object from Lua state
 	cfg := getConfigFromLState(L)
 	// Setup config object
-	cfg.Filepath = configFilePath
+	cfg.Filepath = files[0]
+	cfg.Filepaths = files
+	cfg.DebugLogger = logger
 
 	// Register "xs" predefined global variable
 	xsObject := L.NewTable()
 	L.SetGlobal("xs", xsObject)
-	xsObject.RawSetString("config_file", lua.LString(configFilePath))
-	xsObject.RawSetString("config_dir", lua.LString(filepath.Dir(configFilePath)))
+	configFiles := L.NewTable()
+	for _, file := range files {
+		configFiles.Append(lua.LString(file))
+	}
+	xsObject.RawSetString("config_files", configFiles)
+	xsObject.RawSetString("cache_ttl", L.NewFunction(xsCacheTTLFunc))
+	xsObject.RawSetString("cache_dependency", L.NewFunction(xsCacheDependencyFunc))
 
 	// Load built-in modules
-	L.PreloadModule("xs.debuglogger", luadebuglogger.Loader(debuglogger.Get(cmd)))
-	L.PreloadModule("xs.shell", shell.Loader)
+	L.PreloadModule("xs.debuglogger", luadebuglogger.Loader(logger))
+	L.PreloadModule("xs.inventory", inventory.Loader(getCacheDir(), cfg))
+	L.PreloadModule("xs.json", luajson.Loader)
+	L.PreloadModule("xs.shell", shell.LoaderWithTracker(cfg))
 	L.PreloadModule("xs.template", template.Loader)
+	L.PreloadModule("xs.yaml", luayaml.Loader)
 
 	// Extend package.path
-	// The directory of the config file is added to the package.path.
-	dir := filepath.Dir(configFilePath)
+	// The directories of the config files are added to the package.path.
+	dirs := make([]string, 0, len(files))
+	for _, file := range files {
+		if dir := filepath.Dir(file); !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
 	var additionalPath string
-	if os.PathSeparator == '/' { // unix-like
-		additionalPath = dir + "/?.lua;"
-	} else {
-		additionalPath = dir + "\\?.lua;"
+	for _, dir := range dirs {
+		if os.PathSeparator == '/' { // unix-like
+			additionalPath += dir + "/?.lua;"
+		} else {
+			additionalPath += dir + "\\?.lua;"
+		}
 	}
 
-	if err := L.DoString(`package.path = "` + additionalPath + `" .. package.path`); err != nil {
+	if err := L.DoString(`package.path = ` + luaQuote(additionalPath) + ` .. package.path`); err != nil {
 		return nil, nil, err
 	}
 
-	// Load config file
-	if err := L.DoFile(configFilePath); err != nil {
-		return nil, nil, &ConfigLoadError{Err: err, Path: configFilePath}
+	// Load config files
+	for _, file := range files {
+		cfg.loadingFile = file
+		xsObject.RawSetString("config_file", lua.LString(file))
+		xsObject.RawSetString("config_dir", lua.LString(filepath.Dir(file)))
+		logger.Printf("loading config file: %s", file)
+		if err := L.DoFile(file); err != nil {
+			return nil, nil, &ConfigLoadError{Err: err, Path: file}
+		}
+	}
+	cfg.loadingFile = ""
+
+	multiplex, err := parseMultiplex(xsObject.RawGetString("multiplex"))
+	if err != nil {
+		return nil, nil, &ConfigLoadError{Err: err, Path: cfg.Filepath}
+	}
+	cfg.Multiplex = multiplex
+	cfg.StableSSHConfig = lua.LVAsBool(xsObject.RawGetString("stable_ssh_config"))
+
+	// Merge host templates into the hosts that extend them
+	if err := cfg.resolveHostTemplates(); err != nil {
+		return nil, nil, &ConfigLoadError{Err: err, Path: cfg.Filepath}
+	}
+
+	// Find the problems across the hosts for "xs check"
+	cfg.lintHosts()
+
+	// Import the hosts in the included ssh_config files
+	if err := cfg.importSSHConfigHosts(); err != nil {
+		return nil, nil, &ConfigLoadError{Err: err, Path: cfg.Filepath}
 	}
 
 	return cfg, L, nil
 }
+
+// FilepathsString returns the paths of the loaded config files separated by commas.
+func (cfg *Config) FilepathsString() string {
+	if len(cfg.Filepaths) == 0 {
+		return cfg.Filepath
+	}
+	return strings.Join(cfg.Filepaths, ", ")
+}
@@ -0,0 +1,286 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/kohkimakimoto/xs/internal/debuglogger"
+	"github.com/urfave/cli/v3"
+	"github.com/yuin/gopher-lua"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// configCache is the on-disk cache of the hosts evaluated from the config files.
+// It is used by the commands that only list the hosts like "xs list" and the shell completion,
+// so that they don't need to execute the whole Lua config every time.
+//
+// The cache is valid while the files the hosts depend on are not modified and the TTL is not expired.
+// The files are the config files, the Lua modules loaded by "require", the included ssh_config files
+// the files loaded by the xs.inventory module and the files added by xs.cache_dependency().
+// The TTL is set by the dynamic sources like inventory.command(), and running a command by the xs.shell module
+// disables the cache. The config can override them with xs.cache_ttl().
+type configCache struct {
+	Version   string            `json:"version"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	Files     []*configFileStat `json:"files"`
+	Hosts     []*listItem       `json:"hosts"`
+}
+
+// configFileStat is the state of a file that the cached hosts depend on.
+type configFileStat struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+func newConfigFileStat(path string) *configFileStat {
+	s := &configFileStat{Path: path, Size: -1}
+	if info, err := os.Stat(path); err == nil {
+		s.Size = info.Size()
+		s.ModTime = info.ModTime()
+	}
+	return s
+}
+
+func configCacheVersion() string {
+	return Version + "-" + CommitHash
+}
+
+// configCacheFile returns the path of the cache file for the config files.
+func configCacheFile(files []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(files, "\n")))
+	return filepath.Join(getCacheDir(), "config", hex.EncodeToString(sum[:])+".json")
+}
+
+// readConfigCache returns the cache of the config files. It returns nil if the cache does not exist or is stale.
+func readConfigCache(files []string) *configCache {
+	data, err := os.ReadFile(configCacheFile(files))
+	if err != nil {
+		return nil
+	}
+	c := &configCache{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil
+	}
+	if c.Version != configCacheVersion() {
+		return nil
+	}
+	if !c.ExpiresAt.IsZero() && time.Now().After(c.ExpiresAt) {
+		return nil
+	}
+	for _, f := range c.Files {
+		current := newConfigFileStat(f.Path)
+		if current.Size != f.Size || !current.ModTime.Equal(f.ModTime) {
+			return nil
+		}
+	}
+	return c
+}
+
+// writeConfigCache writes the hosts of the config to the cache.
+// It does nothing if the config disables the cache by setting the TTL to zero.
+func writeConfigCache(cfg *Config, L *lua.LState) error {
+	ttl, ttlSet := cfg.effectiveCacheTTL()
+	if ttlSet && ttl <= 0 {
+		return nil
+	}
+
+	c := &configCache{
+		Version: configCacheVersion(),
+		Files:   make([]*configFileStat, 0),
+		Hosts:   make([]*listItem, 0, len(cfg.Hosts)),
+	}
+	if ttlSet {
+		c.ExpiresAt = time.Now().Add(ttl)
+	}
+	for _, file := range cfg.cacheDependencies(L) {
+		c.Files = append(c.Files, newConfigFileStat(file))
+	}
+	for _, h := range cfg.Hosts {
+		c.Hosts = append(c.Hosts, newListItem(h))
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(configCacheFile(cfg.Filepaths), data, 0600)
+}
+
+// writeFileAtomic writes the data to a temporary file and renames it to the file,
+// so that the readers never see a partially written file.
+func writeFileAtomic(file string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".tmp.*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// AddDependency adds the file that the hosts depend on. The cache is expired when the file is modified.
+func (cfg *Config) AddDependency(file string) {
+	if !slices.Contains(cfg.dependencies, file) {
+		cfg.dependencies = append(cfg.dependencies, file)
+	}
+}
+
+// SetTTL sets the time to live of the cache from a dynamic source. The shortest TTL wins, and zero disables the cache.
+func (cfg *Config) SetTTL(ttl time.Duration) {
+	if !cfg.cacheTTLSet || ttl < cfg.cacheTTL {
+		cfg.cacheTTL = ttl
+		cfg.cacheTTLSet = true
+	}
+}
+
+// setExplicitCacheTTL sets the time to live of the cache by xs.cache_ttl. The shortest TTL wins, and zero disables the cache.
+func (cfg *Config) setExplicitCacheTTL(ttl time.Duration) {
+	if !cfg.explicitCacheTTLSet || ttl < cfg.explicitCacheTTL {
+		cfg.explicitCacheTTL = ttl
+		cfg.explicitCacheTTLSet = true
+	}
+}
+
+// effectiveCacheTTL returns the time to live of the cache and whether it is set.
+// The TTL set by xs.cache_ttl takes precedence over the ones set by the dynamic sources,
+// so that the config that knows its sources can cache them even if they disable the cache.
+func (cfg *Config) effectiveCacheTTL() (time.Duration, bool) {
+	if cfg.explicitCacheTTLSet {
+		return cfg.explicitCacheTTL, true
+	}
+	return cfg.cacheTTL, cfg.cacheTTLSet
+}
+
+// cacheDependencies returns the files that the hosts depend on.
+func (cfg *Config) cacheDependencies(L *lua.LState) []string {
+	files := append([]string{}, cfg.Filepaths...)
+	for _, include := range cfg.SSHConfigIncludes {
+		if matches, err := filepath.Glob(include); err == nil {
+			files = append(files, matches...)
+		}
+		// A new file matched by the glob pattern is detected by the modification time of the directory.
+		files = append(files, filepath.Dir(include))
+	}
+	files = append(files, cfg.dependencies...)
+	files = append(files, loadedLuaModuleFiles(L)...)
+
+	ret := make([]string, 0, len(files))
+	for _, f := range files {
+		if !slices.Contains(ret, f) {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+// loadedLuaModuleFiles returns the files of the Lua modules loaded by "require".
+func loadedLuaModuleFiles(L *lua.LState) []string {
+	files := make([]string, 0)
+	loaded, ok := L.GetField(L.GetGlobal("package"), "loaded").(*lua.LTable)
+	if !ok {
+		return files
+	}
+	path := lua.LVAsString(L.GetField(L.GetGlobal("package"), "path"))
+	loaded.ForEach(func(k, _ lua.LValue) {
+		if file := searchLuaModule(path, lua.LVAsString(k)); file != "" {
+			files = append(files, file)
+		}
+	})
+	slices.Sort(files)
+	return files
+}
+
+// searchLuaModule returns the file of the Lua module searched in the package path, or an empty string.
+func searchLuaModule(path string, name string) string {
+	if name == "" {
+		return ""
+	}
+	name = strings.ReplaceAll(name, ".", string(os.PathSeparator))
+	for _, pattern := range strings.Split(path, ";") {
+		if pattern == "" {
+			continue
+		}
+		file := strings.ReplaceAll(pattern, "?", name)
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			if abs, err := filepath.Abs(file); err == nil {
+				return abs
+			}
+			return file
+		}
+	}
+	return ""
+}
+
+// xsCacheTTLFunc sets the TTL of the cache of the evaluated config like `xs.cache_ttl(300)`.
+// The config that loads hosts from dynamic sources like cloud APIs should call it, or call it with 0 to disable the cache.
+func xsCacheTTLFunc(L *lua.LState) int {
+	seconds := L.CheckNumber(1)
+	getConfigFromLState(L).setExplicitCacheTTL(time.Duration(float64(seconds) * float64(time.Second)))
+	return 0
+}
+
+// xsCacheDependencyFunc adds the file that the hosts depend on like `xs.cache_dependency("/var/db/dhcpd_leases")`.
+// The config or the module that reads a file by itself should call it, so that the cache is expired when the file is modified.
+func xsCacheDependencyFunc(L *lua.LState) int {
+	file := L.CheckString(1)
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	getConfigFromLState(L).AddDependency(file)
+	return 0
+}
+
+// loadHostsForListing returns the hosts for the commands that only list the hosts.
+// It uses the cache of the evaluated config unless it is disabled by the noCache or the XS_NO_CACHE environment variable.
+// The hooks of the hosts from the cache are not available, only the number of them is kept.
+func loadHostsForListing(cmd *cli.Command, noCache bool) ([]*Host, error) {
+	paths, explicit := getConfigFilePaths()
+	files, err := resolveConfigFiles(paths, explicit)
+	if err != nil {
+		return nil, err
+	}
+	logger := debuglogger.Get(cmd)
+
+	useCache := !noCache && !getNoCacheFlag()
+	if useCache {
+		if c := readConfigCache(files); c != nil {
+			logger.Printf("using the cache of the config")
+			hosts := make([]*Host, 0, len(c.Hosts))
+			for _, item := range c.Hosts {
+				hosts = append(hosts, item.toHost())
+			}
+			return hosts, nil
+		}
+	}
+
+	cfg, L, err := loadConfig(files, logger)
+	if err != nil {
+		return nil, err
+	}
+	defer L.Close()
+
+	if useCache {
+		if err := writeConfigCache(cfg, L); err != nil {
+			// Failing to write the cache is not an error because it only makes the next run slower.
+			logger.Printf("failed to write the cache of the config: %v", err)
+		}
+	}
+	return cfg.Hosts, nil
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"github.com/kohkimakimoto/xs/internal/debuglogger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfigCache(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.lua")
+	moduleFile := filepath.Join(dir, "mymodule.lua")
+	files := []string{configFile}
+	require.NoError(t, os.WriteFile(moduleFile, []byte(`return { hostname = "192.168.0.1" }`), 0644))
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+local m = require "mymodule"
+host "web1" {
+  tags = { "web" },
+  ssh_config = { HostName = m.hostname },
+  on_before_connect = { "echo hi" },
+}
+`), 0644))
+
+	load := func() {
+		cfg, L, err := loadConfig(files, debuglogger.New(io.Discard, false, true))
+		require.NoError(t, err)
+		defer L.Close()
+		require.NoError(t, writeConfigCache(cfg, L))
+	}
+
+	load()
+	c := readConfigCache(files)
+	require.NotNil(t, c)
+	assert.Equal(t, []string{configFile, moduleFile}, []string{c.Files[0].Path, c.Files[1].Path})
+	require.Len(t, c.Hosts, 1)
+	h := c.Hosts[0].toHost()
+	assert.Equal(t, "web1", h.Name)
+	assert.Equal(t, []string{"web"}, h.Tags)
+	assert.Equal(t, map[string]string{"HostName": "192.168.0.1"}, h.SSHConfig)
+	assert.Len(t, h.OnBeforeConnect, 1)
+
+	// modifying the module expires the cache
+	require.NoError(t, os.WriteFile(moduleFile, []byte(`return { hostname = "192.168.0.100" }`), 0644))
+	assert.Nil(t, readConfigCache(files))
+
+	// the TTL set by the config expires the cache
+	require.NoError(t, os.WriteFile(configFile, []byte(`xs.cache_ttl(0.01); xs.cache_ttl(60); host "web1" {}`), 0644))
+	load()
+	require.NotNil(t, readConfigCache(files))
+	time.Sleep(20 * time.Millisecond)
+	assert.Nil(t, readConfigCache(files))
+
+	// the command of the inventory without the cache option disables the cache
+	require.NoError(t, os.RemoveAll(getCacheDir()))
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+local inventory = require "xs.inventory"
+for _, h in ipairs(assert(inventory.command("echo '[{\"name\": \"web1\"}]'"))) do host(h) end
+`), 0644))
+	load()
+	assert.Nil(t, readConfigCache(files))
+	_, err := os.Stat(configCacheFile(files))
+	assert.True(t, os.IsNotExist(err))
+
+	// running a command by xs.shell disables the cache
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+local shell = require "xs.shell"
+host((shell.run("echo web1"):stdout():gsub("%s+$", "")))
+`), 0644))
+	load()
+	assert.Nil(t, readConfigCache(files))
+	_, err = os.Stat(configCacheFile(files))
+	assert.True(t, os.IsNotExist(err))
+
+	// xs.cache_ttl takes precedence over xs.shell and inventory.command
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+local shell = require "xs.shell"
+local inventory = require "xs.inventory"
+xs.cache_ttl(300)
+host((shell.run("echo web1"):stdout():gsub("%s+$", "")))
+for _, h in ipairs(assert(inventory.command("echo '[{\"name\": \"web2\"}]'"))) do host(h) end
+`), 0644))
+	load()
+	c = readConfigCache(files)
+	require.NotNil(t, c)
+	require.Len(t, c.Hosts, 2)
+	assert.WithinDuration(t, time.Now().Add(300*time.Second), c.ExpiresAt, 10*time.Second)
+
+	// modifying the file added by xs.cache_dependency expires the cache
+	leasesFile := filepath.Join(dir, "leases")
+	require.NoError(t, os.WriteFile(leasesFile, []byte("web1"), 0644))
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+xs.cache_dependency("`+leasesFile+`")
+local f = io.open("`+leasesFile+`")
+host(f:read("*a"))
+f:close()
+`), 0644))
+	load()
+	require.NotNil(t, readConfigCache(files))
+	require.NoError(t, os.WriteFile(leasesFile, []byte("web1\nweb2"), 0644))
+	assert.Nil(t, readConfigCache(files))
+}
@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"github.com/kohkimakimoto/xs/internal/debuglogger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.lua")
+	confDir := filepath.Join(dir, "conf.d")
+	require.NoError(t, os.Mkdir(confDir, 0755))
+	for _, name := range []string{"config.lua", "conf.d/20-b.lua", "conf.d/10-a.lua", "conf.d/README.md"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(""), 0644))
+	}
+
+	files, err := resolveConfigFiles([]string{configFile, confDir}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{configFile, filepath.Join(confDir, "10-a.lua"), filepath.Join(confDir, "20-b.lua")}, files)
+
+	// the same file is loaded once
+	files, err = resolveConfigFiles([]string{filepath.Join(confDir, "20-b.lua"), confDir}, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(confDir, "20-b.lua"), filepath.Join(confDir, "10-a.lua")}, files)
+
+	// the missing default paths are skipped
+	missing := filepath.Join(dir, "missing.lua")
+	files, err = resolveConfigFiles([]string{missing, confDir}, false)
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	_, err = resolveConfigFiles([]string{configFile, missing}, true)
+	assert.EqualError(t, err, "failed to load config "+missing+" (no config file)")
+
+	_, err = resolveConfigFiles([]string{missing}, false)
+	assert.EqualError(t, err, "failed to load config "+missing+" (no config file)")
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{filepath.Join(dir, "config.lua"), filepath.Join(dir, "local.lua")}
+	require.NoError(t, os.WriteFile(files[0], []byte(`
+host_template "base" { ssh_config = { User = "deploy" } }
+host "web1" { description = "shared", extends = "base" }
+host "web2" { description = "shared" }
+`), 0644))
+	require.NoError(t, os.WriteFile(files[1], []byte(`
+host_template "base" { ssh_config = { User = "me" } }
+host "web1" { description = "local:" .. xs.config_file, extends = "base" }
+host "db1" { description = #xs.config_files }
+`), 0644))
+
+	cfg, L, err := loadConfig(files, debuglogger.New(io.Discard, false, true))
+	require.NoError(t, err)
+	defer L.Close()
+
+	assert.Equal(t, files[0], cfg.Filepath)
+	assert.Equal(t, files, cfg.Filepaths)
+	names := make([]string, 0)
+	for _, h := range cfg.Hosts {
+		names = append(names, h.Name)
+	}
+	// the redefined host keeps the position of the first definition
+	assert.Equal(t, []string{"web1", "web2", "db1"}, names)
+
+	web1 := cfg.NewHostFilter().GetHostByName("web1")
+	assert.Equal(t, "local:"+files[1], web1.Description)
+	assert.Equal(t, map[string]string{"User": "me"}, web1.SSHConfig)
+	assert.Equal(t, "2", cfg.NewHostFilter().GetHostByName("db1").Description)
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{filepath.Join(dir, "config.lua"), filepath.Join(dir, "broken.lua")}
+	require.NoError(t, os.WriteFile(files[0], []byte(`host "web1" {}`), 0644))
+
+	// redefining a host in the same file is an error
+	require.NoError(t, os.WriteFile(files[1], []byte(`host "db1" {}`+"\n"+`host "db1" {}`), 0644))
+	_, _, err := loadConfig(files, debuglogger.New(io.Discard, false, true))
+	var loadErr *ConfigLoadError
+	require.ErrorAs(t, err, &loadErr)
+	assert.Equal(t, files[1], loadErr.Path)
+	assert.Contains(t, err.Error(), "host db1 already registered")
+
+	require.NoError(t, os.WriteFile(files[1], []byte(`host "db1" {`), 0644))
+	_, _, err = loadConfig(files, debuglogger.New(io.Discard, false, true))
+	require.ErrorAs(t, err, &loadErr)
+	assert.Equal(t, files[1], loadErr.Path)
+}
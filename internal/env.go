@@ -6,19 +6,52 @@ import (
 	"runtime"
 )
 
-func getConfigFilePath() string {
-	if f := os.Getenv("XS_CONFIG"); f != "" {
-		if filepath.IsAbs(f) {
-			return f
-		}
+// getConfigFilePaths returns the paths of the config files and directories, and whether they are specified explicitly.
+// XS_CONFIG can have multiple paths separated by the path list separator (":" on unix-like systems).
+// The default is "~/.xs/config.lua" and the "~/.xs/conf.d" directory.
+func getConfigFilePaths() ([]string, bool) {
+	if v := os.Getenv("XS_CONFIG"); v != "" {
 		wd, _ := os.Getwd()
-		return filepath.Join(wd, f)
+		paths := make([]string, 0)
+		for _, f := range filepath.SplitList(v) {
+			if f == "" {
+				continue
+			}
+			if !filepath.IsAbs(f) {
+				f = filepath.Join(wd, f)
+			}
+			paths = append(paths, f)
+		}
+		return paths, true
 	}
 
 	// default
 	home := userHomeDir()
 	userDataDir := filepath.Join(home, ".xs")
-	return filepath.Join(userDataDir, "config.lua")
+	return []string{
+		filepath.Join(userDataDir, "config.lua"),
+		filepath.Join(userDataDir, "conf.d"),
+	}, false
+}
+
+// getCacheDir returns the directory to store the cache files.
+func getCacheDir() string {
+	return filepath.Join(userHomeDir(), ".xs", "cache")
+}
+
+// getSSHConfigDir returns the directory to store the stable ssh_config files.
+func getSSHConfigDir() string {
+	return filepath.Join(userHomeDir(), ".xs", "ssh_config")
+}
+
+// getTunnelStateDir returns the directory to store the states and the control sockets of the tunnels.
+func getTunnelStateDir() string {
+	return filepath.Join(userHomeDir(), ".xs", "tunnels")
+}
+
+// getMultiplexDir returns the directory to store the control sockets of the multiplexed connections.
+func getMultiplexDir() string {
+	return filepath.Join(userHomeDir(), ".xs", "mux")
 }
 
 func userHomeDir() string {
@@ -40,6 +73,20 @@ func getDebugFlag() bool {
 	return false
 }
 
+const (
+	sshClientOpenSSH = "openssh"
+	sshClientNative  = "native"
+)
+
+// getSSHClientFlag returns the ssh client to connect to hosts.
+// "openssh" runs the ssh command, and "native" uses the built-in ssh client.
+func getSSHClientFlag() string {
+	if v := os.Getenv("XS_SSH_CLIENT"); v == sshClientNative {
+		return sshClientNative
+	}
+	return sshClientOpenSSH
+}
+
 func getNoColorFlag() bool {
 	v := os.Getenv("XS_NO_COLOR")
 	if v == "1" || v == "true" || v == "TRUE" || v == "True" || v == "yes" || v == "YES" || v == "Yes" || v == "on" || v == "ON" || v == "On" {
@@ -47,3 +94,11 @@ func getNoColorFlag() bool {
 	}
 	return false
 }
+
+func getNoCacheFlag() bool {
+	v := os.Getenv("XS_NO_CACHE")
+	if v == "1" || v == "true" || v == "TRUE" || v == "True" || v == "yes" || v == "YES" || v == "Yes" || v == "on" || v == "ON" || v == "On" {
+		return true
+	}
+	return false
+}
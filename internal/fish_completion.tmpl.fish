@@ -0,0 +1,99 @@
+# This is a fish completion script for xs
+# If you want to use this script, add the following line to your config.fish
+# ----------------------------------
+# xs fish-completion | source
+# ----------------------------------
+
+function __xs_hosts
+    {{ .Executable }} fish-completion --hosts 2>/dev/null
+end
+
+# Returns the builtin command or destination if it has already been typed.
+function __xs_destination
+    set -l tokens (commandline -opc)
+    set -l skip 0
+    for token in $tokens[2..-1]
+        if test $skip -eq 1
+            set skip 0
+            continue
+        end
+        switch $token
+            case -B -b -c -D -E -e -F -I -i -J -L -l -m -O -o -p -Q -R -S -W -w
+                set skip 1
+            case '-*'
+            case '*'
+                echo $token
+                return 0
+        end
+    end
+    return 1
+end
+
+function __xs_needs_destination
+    not __xs_destination >/dev/null
+end
+
+function __xs_using_command
+    set -l destination (__xs_destination)
+    test "$destination" = "$argv[1]"
+end
+
+complete -c xs -e
+
+# builtin commands and destination hosts
+complete -c xs -f -n __xs_needs_destination -a '(__xs_hosts)'
+{{- range .Commands }}
+complete -c xs -f -n __xs_needs_destination -a {{ fishQuote .Name }} -d {{ fishQuote .Usage }}
+{{- end }}
+
+# builtin command arguments
+complete -c xs -f -n '__xs_using_command exec; and test (count (commandline -opc)) -eq 2' -a '(__xs_hosts)'
+complete -c xs -f -n '__xs_using_command sftp' -a '(__xs_hosts)'
+complete -c xs -n '__xs_using_command scp; or __xs_using_command rsync' -a '(__xs_hosts | string replace -r "\t" ":\t")'
+
+# ssh options
+complete -c xs -n __xs_needs_destination -s h -d 'Show a help message and exit'
+complete -c xs -n __xs_needs_destination -s 4 -d 'Force ssh to use IPv4 addresses only'
+complete -c xs -n __xs_needs_destination -s 6 -d 'Force ssh to use IPv6 addresses only'
+complete -c xs -n __xs_needs_destination -s A -d 'Enable forwarding of the authentication agent connection'
+complete -c xs -n __xs_needs_destination -s a -d 'Disable forwarding of the authentication agent connection'
+complete -c xs -n __xs_needs_destination -s B -x -d 'Bind to the address of the interface'
+complete -c xs -n __xs_needs_destination -s b -x -d 'Bind to the local address'
+complete -c xs -n __xs_needs_destination -s C -d 'Compress data'
+complete -c xs -n __xs_needs_destination -s c -x -d 'Select encryption cipher'
+complete -c xs -n __xs_needs_destination -s D -x -d 'Specify a dynamic port forwarding'
+complete -c xs -n __xs_needs_destination -s E -r -d 'Append log output to file instead of stderr'
+complete -c xs -n __xs_needs_destination -s e -x -d 'Set escape character'
+complete -c xs -n __xs_needs_destination -s F -r -d 'Specify alternate config file'
+complete -c xs -n __xs_needs_destination -s f -d 'Go to background'
+complete -c xs -n __xs_needs_destination -s G -d 'Output configuration and exit'
+complete -c xs -n __xs_needs_destination -s g -d 'Allow remote hosts to connect to local forwarded ports'
+complete -c xs -n __xs_needs_destination -s I -r -d 'Specify smartcard device'
+complete -c xs -n __xs_needs_destination -s i -r -d 'Select identity file'
+complete -c xs -n __xs_needs_destination -s J -x -a '(__xs_hosts)' -d 'Connect via a jump host'
+complete -c xs -n __xs_needs_destination -s K -d 'Enable GSSAPI-based authentication and forwarding'
+complete -c xs -n __xs_needs_destination -s k -d 'Disable forwarding of GSSAPI credentials'
+complete -c xs -n __xs_needs_destination -s L -x -d 'Specify local port forwarding'
+complete -c xs -n __xs_needs_destination -s l -x -a '(__fish_complete_users)' -d 'Specify login name'
+complete -c xs -n __xs_needs_destination -s M -d 'Master mode for connection sharing'
+complete -c xs -n __xs_needs_destination -s m -x -d 'Specify mac algorithms'
+complete -c xs -n __xs_needs_destination -s N -d "Don't execute a remote command"
+complete -c xs -n __xs_needs_destination -s n -d 'Redirect stdin from /dev/null'
+complete -c xs -n __xs_needs_destination -s O -x -a 'check forward cancel exit stop proxy' -d 'Control an active connection multiplexing master process'
+complete -c xs -n __xs_needs_destination -s o -x -d 'Specify extra options'
+complete -c xs -n __xs_needs_destination -s p -x -d 'Specify port on remote host'
+complete -c xs -n __xs_needs_destination -s Q -x -d 'Query for the algorithms supported by ssh'
+complete -c xs -n __xs_needs_destination -s q -d 'Quiet operation'
+complete -c xs -n __xs_needs_destination -s R -x -d 'Specify remote port forwarding'
+complete -c xs -n __xs_needs_destination -s S -r -d 'Specify location of control socket for connection sharing'
+complete -c xs -n __xs_needs_destination -s s -d 'Invoke subsystem'
+complete -c xs -n __xs_needs_destination -s T -d 'Disable pseudo-tty allocation'
+complete -c xs -n __xs_needs_destination -s t -d 'Force pseudo-tty allocation'
+complete -c xs -n __xs_needs_destination -s V -d 'Show version number'
+complete -c xs -n __xs_needs_destination -s v -d 'Verbose mode'
+complete -c xs -n __xs_needs_destination -s W -x -d 'Forward standard input and output to host'
+complete -c xs -n __xs_needs_destination -s w -x -d 'Request tunnel device forwarding'
+complete -c xs -n __xs_needs_destination -s X -d 'Enable (untrusted) X11 forwarding'
+complete -c xs -n __xs_needs_destination -s x -d 'Disable X11 forwarding'
+complete -c xs -n __xs_needs_destination -s Y -d 'Enable trusted X11 forwarding'
+complete -c xs -n __xs_needs_destination -s y -d 'Send log info via syslog instead of stderr'
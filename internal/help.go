@@ -12,11 +12,14 @@ Builtin commands:{{template "visibleCommandCategoryTemplate" .}}
 
 Destination Hosts:
    You can define destination hosts in the configuration file.
+   If the destination is "-", you can pick a host interactively like "xs pick".
 
 Environment variables:
-   XS_CONFIG_FILE  Path to the configuration file. Default is ~/.xs/config.lua
+   XS_CONFIG       Paths to the configuration files. Default is ~/.xs/config.lua and ~/.xs/conf.d
    XS_DEBUG        If set to "true", XS will output debug information.
+   XS_NO_CACHE     If set to "true", XS will not use the cache of the evaluated configuration.
    XS_NO_COLOR     If set to "true", XS will not output color codes in debug information.
+   XS_SSH_CLIENT   If set to "native", XS will use the built-in SSH client instead of the ssh command.
 
 Version: {{ .Version }}
 Commit: {{ .Metadata.CommitHash }}
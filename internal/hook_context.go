@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"github.com/yuin/gopher-lua"
+	"time"
+)
+
+// hookContext is the information about a connection passed to the hooks defined as Lua functions.
+type hookContext struct {
+	Host        *Host
+	Destination string
+	Hostname    string
+	User        string
+	Port        string
+	Options     []string
+	Command     string
+	// ExitCode and Duration are set after the ssh command exits.
+	ExitCode *int
+	Duration time.Duration
+}
+
+// newHookContext creates a hook context for the destination.
+// The user and port are resolved in the same precedence as ssh: the destination, the options, and then the ssh_config.
+func newHookContext(cfg *Config, host *Host, destination string, options []string, command string) *hookContext {
+	user, hostname, port := parseDestination(destination)
+
+	for i := 0; i+1 < len(options); i++ {
+		switch options[i] {
+		case "-l":
+			if user == "" {
+				user = options[i+1]
+			}
+			i++
+		case "-p":
+			if port == "" {
+				port = options[i+1]
+			}
+			i++
+		}
+	}
+
+	values := effectiveSSHConfig(cfg, hostname)
+	if user == "" {
+		user = values["user"]
+	}
+	if port == "" {
+		port = values["port"]
+	}
+
+	return &hookContext{
+		Host:        host,
+		Destination: destination,
+		Hostname:    hostname,
+		User:        user,
+		Port:        port,
+		Options:     append([]string{}, options...),
+		Command:     command,
+	}
+}
+
+// setResult sets the result of the ssh command.
+func (c *hookContext) setResult(err error, duration time.Duration) {
+	exitCode := resolveExitCode(err)
+	c.ExitCode = &exitCode
+	c.Duration = duration
+}
+
+func (c *hookContext) toLuaTable(L *lua.LState) *lua.LTable {
+	tb := L.NewTable()
+	if c.Host != nil {
+		tb.RawSetString("host", newLuaHost(L, c.Host))
+	}
+	tb.RawSetString("destination", lua.LString(c.Destination))
+	tb.RawSetString("hostname", lua.LString(c.Hostname))
+	if c.User != "" {
+		tb.RawSetString("user", lua.LString(c.User))
+	}
+	if c.Port != "" {
+		tb.RawSetString("port", lua.LString(c.Port))
+	}
+	options := L.NewTable()
+	for _, opt := range c.Options {
+		options.Append(lua.LString(opt))
+	}
+	tb.RawSetString("options", options)
+	tb.RawSetString("command", lua.LString(c.Command))
+	if c.ExitCode != nil {
+		tb.RawSetString("exit_code", lua.LNumber(*c.ExitCode))
+		tb.RawSetString("duration", lua.LNumber(c.Duration.Seconds()))
+	}
+	return tb
+}
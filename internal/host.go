@@ -2,18 +2,34 @@ package internal
 
 import (
 	"fmt"
+	"github.com/kohkimakimoto/xs/internal/lualib/shell"
 	"github.com/yuin/gopher-lua"
 	"sort"
+	"strings"
 )
 
 type Host struct {
-	Name              string
-	Description       string
-	Hidden            bool
+	Name        string
+	Description string
+	Hidden      bool
+	Tags        []string
+	Extends     []string
+	Match       string
+	// SSHConfig is the ssh_config parameters. Multiple values of a keyword like IdentityFile are joined by "\n".
 	SSHConfig         map[string]string
 	OnBeforeConnect   []any
 	OnAfterConnect    []any
 	OnAfterDisconnect []any
+	OnBeforeCommand   []any
+	OnAfterCommand    []any
+	// Tunnels is the local port forwardings started by "xs tunnel up".
+	Tunnels []*Tunnel
+	// ImportedFrom is the path of the ssh_config file if the host is imported by include_ssh_config.
+	ImportedFrom string
+	// pos is the position in the Lua source where the host is defined.
+	pos string
+	// file is the config file where the host is defined.
+	file string
 }
 
 func (h *Host) SortedSSHConfig() []map[string]string {
@@ -26,14 +42,30 @@ func (h *Host) SortedSSHConfig() []map[string]string {
 	sort.Strings(names)
 
 	for _, name := range names {
-		v := h.SSHConfig[name]
-		value := map[string]string{name: v}
-		values = append(values, value)
+		// a keyword with multiple values is output as multiple lines
+		for _, v := range strings.Split(h.SSHConfig[name], "\n") {
+			values = append(values, map[string]string{name: v})
+		}
 	}
 
 	return values
 }
 
+// IsPattern reports whether the host is a pattern host that produces a "Host" section with patterns like "*.example.com"
+// or a "Match" section, rather than a concrete destination.
+func (h *Host) IsPattern() bool {
+	return h.Match != "" || isSSHPattern(h.Name)
+}
+
+// MatchesHostname reports whether the "Host" section of the host applies to the hostname.
+// It always returns false for the "Match" section because its criteria can not be evaluated by XS.
+func (h *Host) MatchesHostname(hostname string) bool {
+	if h.Match != "" {
+		return false
+	}
+	return matchSSHPatternList(h.Name, hostname)
+}
+
 const luaHostTypeName = "Host*"
 
 func registerLuaHostType(L *lua.LState) {
@@ -45,7 +77,30 @@ func registerLuaHostType(L *lua.LState) {
 
 func xsHostFunc(L *lua.LState) int {
 	l := L.GetTop()
-	if l == 1 {
+	if l == 1 && L.Get(1).Type() == lua.LTTable {
+		// If it passes a table that has the name, define a new host like `host { name = "name", description = "desc" }`.
+		// It accepts the hosts loaded by the xs.inventory module as they are.
+		tb := L.CheckTable(1)
+		name := lua.LVAsString(tb.RawGetString("name"))
+		if name == "" {
+			L.ArgError(1, "host table must have the name")
+		}
+		h, err := registerNewHost(L, name)
+		if err != nil {
+			L.RaiseError("failed to register new host: %v", err)
+		}
+		// apply host config
+		tb.ForEach(func(k, v lua.LValue) {
+			if key := lua.LVAsString(k); key != "" {
+				if err := setHostParam(L, h, key, v); err != nil {
+					L.RaiseError("failed to parse host config: %v", err)
+				}
+			}
+		})
+
+		// return host object to Lua world
+		L.Push(newLuaHost(L, h))
+	} else if l == 1 {
 		// If it passes 1 argument, return host object for DSL style like `host "name" { description = "desc" })`
 		name := L.CheckString(1)
 		h, err := registerNewHost(L, name)
@@ -68,7 +123,7 @@ func xsHostFunc(L *lua.LState) int {
 		// apply host config
 		tb.ForEach(func(k, v lua.LValue) {
 			if key := lua.LVAsString(k); key != "" {
-				if err := updateHost(h, key, v); err != nil {
+				if err := setHostParam(L, h, key, v); err != nil {
 					L.RaiseError("failed to parse host config: %v", err)
 				}
 			}
@@ -83,15 +138,18 @@ func xsHostFunc(L *lua.LState) int {
 }
 
 func registerNewHost(L *lua.LState, name string) (*Host, error) {
+	cfg := getConfigFromLState(L)
+
 	// create new host object
 	h := &Host{
 		Name:        name,
 		Description: "",
 		SSHConfig:   map[string]string{},
+		pos:         luaCallerPos(L),
+		file:        cfg.loadingFile,
 	}
 
 	// update config state
-	cfg := getConfigFromLState(L)
 	if err := cfg.AddHost(h); err != nil {
 		return nil, err
 	}
@@ -113,78 +171,155 @@ func updateHost(h *Host, key string, value lua.LValue) error {
 		h.Description = lua.LVAsString(value)
 	case "hidden":
 		h.Hidden = lua.LVAsBool(value)
-	case "ssh_config":
-		if tb, ok := value.(*lua.LTable); ok {
-			tb.ForEach(func(k, v lua.LValue) {
-				if key := lua.LVAsString(k); key != "" {
-					h.SSHConfig[key] = lua.LVAsString(v)
-				}
-			})
-		} else {
-			return fmt.Errorf("ssh_config must be a table but got %s", value.Type().String())
-		}
-	case "on_before_connect":
-		// on_before_connect must be a table of string or function
+	case "match":
+		h.Match = lua.LVAsString(value)
+	case "tags":
+		// tags must be a table of string
 		if tb, ok := value.(*lua.LTable); ok {
-			hooks := make([]any, 0)
+			tags := make([]string, 0)
 			tb.ForEach(func(_, v lua.LValue) {
 				if vs, ok := v.(lua.LString); ok {
-					// string value
-					hooks = append(hooks, vs)
-				} else if vfn, ok := v.(*lua.LFunction); ok {
-					// function value
-					hooks = append(hooks, vfn)
+					tags = append(tags, string(vs))
 				}
 			})
-			h.OnBeforeConnect = hooks
+			h.Tags = tags
 		} else {
-			return fmt.Errorf("on_before_connect must be a table but got %s", value.Type().String())
+			return fmt.Errorf("tags must be a table but got %s", value.Type().String())
 		}
-	case "on_after_connect":
-		// on_after_connect must be a table of string or function
-		if tb, ok := value.(*lua.LTable); ok {
-			hooks := make([]any, 0)
+	case "extends":
+		// extends must be a string or a table of string
+		if vs, ok := value.(lua.LString); ok {
+			h.Extends = []string{string(vs)}
+		} else if tb, ok := value.(*lua.LTable); ok {
+			extends := make([]string, 0)
 			tb.ForEach(func(_, v lua.LValue) {
 				if vs, ok := v.(lua.LString); ok {
-					// string value
-					hooks = append(hooks, vs)
-				} else if vfn, ok := v.(*lua.LFunction); ok {
-					// function value
-					hooks = append(hooks, vfn)
+					extends = append(extends, string(vs))
 				}
 			})
-			h.OnAfterConnect = hooks
+			h.Extends = extends
 		} else {
-			return fmt.Errorf("on_after_connect must be a table but got %s", value.Type().String())
+			return fmt.Errorf("extends must be a string or a table but got %s", value.Type().String())
 		}
-	case "on_after_disconnect":
-		// on_after_disconnect must be a table of string or function
+	case "ssh_config":
 		if tb, ok := value.(*lua.LTable); ok {
-			hooks := make([]any, 0)
-			tb.ForEach(func(_, v lua.LValue) {
-				if vs, ok := v.(lua.LString); ok {
-					// string value
-					hooks = append(hooks, vs)
-				} else if vfn, ok := v.(*lua.LFunction); ok {
-					// function value
-					hooks = append(hooks, vfn)
+			tb.ForEach(func(k, v lua.LValue) {
+				if key := lua.LVAsString(k); key != "" {
+					if vtb, ok := v.(*lua.LTable); ok {
+						// multiple values like `IdentityFile = { "~/.ssh/id_a", "~/.ssh/id_b" }`
+						values := make([]string, 0, vtb.Len())
+						for i := 1; i <= vtb.Len(); i++ {
+							values = append(values, lua.LVAsString(vtb.RawGetInt(i)))
+						}
+						h.SSHConfig[key] = strings.Join(values, "\n")
+					} else {
+						h.SSHConfig[key] = lua.LVAsString(v)
+					}
 				}
 			})
-			h.OnAfterDisconnect = hooks
 		} else {
-			return fmt.Errorf("on_after_disconnect must be a table but got %s", value.Type().String())
+			return fmt.Errorf("ssh_config must be a table but got %s", value.Type().String())
 		}
+	case "on_before_connect":
+		hooks, err := parseHooks(key, value)
+		if err != nil {
+			return err
+		}
+		h.OnBeforeConnect = hooks
+	case "on_after_connect":
+		hooks, err := parseHooks(key, value)
+		if err != nil {
+			return err
+		}
+		h.OnAfterConnect = hooks
+	case "on_after_disconnect":
+		hooks, err := parseHooks(key, value)
+		if err != nil {
+			return err
+		}
+		h.OnAfterDisconnect = hooks
+	case "on_before_command":
+		hooks, err := parseHooks(key, value)
+		if err != nil {
+			return err
+		}
+		h.OnBeforeCommand = hooks
+	case "on_after_command":
+		hooks, err := parseHooks(key, value)
+		if err != nil {
+			return err
+		}
+		h.OnAfterCommand = hooks
+	case "tunnels":
+		tunnels, err := parseTunnels(value)
+		if err != nil {
+			return err
+		}
+		h.Tunnels = tunnels
 	}
 	return nil
 }
 
+// parseHooks parses a hook parameter. It must be a table of string, function or argv list like {"rsync", "-a", src, dst}.
+func parseHooks(key string, value lua.LValue) ([]any, error) {
+	tb, ok := value.(*lua.LTable)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a table but got %s", key, value.Type().String())
+	}
+	hooks := make([]any, 0)
+	var err error
+	tb.ForEach(func(_, v lua.LValue) {
+		if err != nil {
+			return
+		}
+		if vs, ok := v.(lua.LString); ok {
+			// string value
+			hooks = append(hooks, vs)
+		} else if vfn, ok := v.(*lua.LFunction); ok {
+			// function value
+			hooks = append(hooks, vfn)
+		} else if vtb, ok := v.(*lua.LTable); ok {
+			// argv value
+			argv, argvErr := shell.ToArgv(vtb)
+			if argvErr != nil {
+				err = fmt.Errorf("%s has an invalid hook: %w", key, argvErr)
+				return
+			}
+			hooks = append(hooks, argv)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
+
+func newLuaHooksTable(L *lua.LState, hooks []any) *lua.LTable {
+	tb := L.NewTable()
+	for i, v := range hooks {
+		switch vv := v.(type) {
+		case lua.LString:
+			tb.RawSetInt(i+1, vv)
+		case *lua.LFunction:
+			tb.RawSetInt(i+1, vv)
+		case []string:
+			argv := L.CreateTable(len(vv), 0)
+			for _, arg := range vv {
+				argv.Append(lua.LString(arg))
+			}
+			tb.RawSetInt(i+1, argv)
+		}
+	}
+	return tb
+}
+
 func luaHostCall(L *lua.LState) int {
 	h := checkHost(L)
 	tb := L.CheckTable(2)
 	// apply host config
 	tb.ForEach(func(k, v lua.LValue) {
 		if key := lua.LVAsString(k); key != "" {
-			if err := updateHost(h, key, v); err != nil {
+			if err := setHostParam(L, h, key, v); err != nil {
 				L.RaiseError("failed to parse host config: %v", err)
 			}
 		}
@@ -207,48 +342,55 @@ func luaHostIndex(L *lua.LState) int {
 	case "hidden":
 		L.Push(lua.LBool(h.Hidden))
 		return 1
-	case "ssh_config":
+	case "match":
+		L.Push(lua.LString(h.Match))
+		return 1
+	case "tags":
 		tb := L.NewTable()
-		for k, v := range h.SSHConfig {
-			tb.RawSetString(k, lua.LString(v))
+		for i, v := range h.Tags {
+			tb.RawSetInt(i+1, lua.LString(v))
 		}
 		L.Push(tb)
 		return 1
-	case "on_before_connect":
+	case "extends":
 		tb := L.NewTable()
-		for i, v := range h.OnBeforeConnect {
-			switch vv := v.(type) {
-			case lua.LString:
-				tb.RawSetInt(i+1, vv)
-			case *lua.LFunction:
-				tb.RawSetInt(i+1, vv)
-			}
+		for i, v := range h.Extends {
+			tb.RawSetInt(i+1, lua.LString(v))
 		}
 		L.Push(tb)
 		return 1
-	case "on_after_connect":
+	case "ssh_config":
 		tb := L.NewTable()
-		for i, v := range h.OnAfterConnect {
-			switch vv := v.(type) {
-			case lua.LString:
-				tb.RawSetInt(i+1, vv)
-			case *lua.LFunction:
-				tb.RawSetInt(i+1, vv)
+		for k, v := range h.SSHConfig {
+			if values := strings.Split(v, "\n"); len(values) > 1 {
+				vtb := L.NewTable()
+				for _, vv := range values {
+					vtb.Append(lua.LString(vv))
+				}
+				tb.RawSetString(k, vtb)
+			} else {
+				tb.RawSetString(k, lua.LString(v))
 			}
 		}
 		L.Push(tb)
 		return 1
+	case "on_before_connect":
+		L.Push(newLuaHooksTable(L, h.OnBeforeConnect))
+		return 1
+	case "on_after_connect":
+		L.Push(newLuaHooksTable(L, h.OnAfterConnect))
+		return 1
 	case "on_after_disconnect":
-		tb := L.NewTable()
-		for i, v := range h.OnAfterDisconnect {
-			switch vv := v.(type) {
-			case lua.LString:
-				tb.RawSetInt(i+1, vv)
-			case *lua.LFunction:
-				tb.RawSetInt(i+1, vv)
-			}
-		}
-		L.Push(tb)
+		L.Push(newLuaHooksTable(L, h.OnAfterDisconnect))
+		return 1
+	case "on_before_command":
+		L.Push(newLuaHooksTable(L, h.OnBeforeCommand))
+		return 1
+	case "on_after_command":
+		L.Push(newLuaHooksTable(L, h.OnAfterCommand))
+		return 1
+	case "tunnels":
+		L.Push(newLuaTunnelsTable(L, h.Tunnels))
 		return 1
 	default:
 		L.Push(lua.LNil)
@@ -261,7 +403,7 @@ func luaHostNewIndex(L *lua.LState) int {
 	key := L.CheckString(2)
 	value := L.CheckAny(3)
 
-	if err := updateHost(h, key, value); err != nil {
+	if err := setHostParam(L, h, key, value); err != nil {
 		L.RaiseError("failed to parse host config: %v", err)
 	}
 	return 0
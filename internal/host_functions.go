@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/yuin/gopher-lua"
+	"slices"
+	"strings"
+)
+
+// newLuaHostFunctions creates the "host" global value. It defines a host by calling it like `host "name" { ... }`,
+// and it has the functions to customize the hosts defined already, like the hosts in a shared config file:
+//   - host.get(name): returns the host or nil.
+//   - host.amend(name, params): merges the parameters into the host. `host.amend "name" { ... }` is also available.
+//   - host.remove(name): removes the host and returns whether it existed.
+//   - host.rename(name, new_name): renames the host.
+func newLuaHostFunctions(L *lua.LState) *lua.LTable {
+	tb := L.NewTable()
+	tb.RawSetString("get", L.NewFunction(xsHostGetFunc))
+	tb.RawSetString("amend", L.NewFunction(xsHostAmendFunc))
+	tb.RawSetString("remove", L.NewFunction(xsHostRemoveFunc))
+	tb.RawSetString("rename", L.NewFunction(xsHostRenameFunc))
+
+	mt := L.NewTable()
+	mt.RawSetString("__call", L.NewFunction(func(L *lua.LState) int {
+		// remove the "host" table itself passed by the __call metamethod
+		L.Remove(1)
+		return xsHostFunc(L)
+	}))
+	L.SetMetatable(tb, mt)
+	return tb
+}
+
+func xsHostGetFunc(L *lua.LState) int {
+	name := L.CheckString(1)
+	h := getConfigFromLState(L).NewHostFilter().GetHostByName(name)
+	if h == nil {
+		L.Push(lua.LNil)
+		return 1
+	}
+	L.Push(newLuaHost(L, h))
+	return 1
+}
+
+func xsHostAmendFunc(L *lua.LState) int {
+	name := L.CheckString(1)
+	h := getConfigFromLState(L).NewHostFilter().GetHostByName(name)
+	if h == nil {
+		L.RaiseError("failed to amend host: host %s is not defined", name)
+	}
+
+	if L.GetTop() == 1 {
+		// DSL style like `host.amend "name" { ... }`
+		L.Push(L.NewFunction(func(L *lua.LState) int {
+			amendHost(L, h, L.CheckTable(1))
+			L.Push(newLuaHost(L, h))
+			return 1
+		}))
+		return 1
+	}
+	amendHost(L, h, L.CheckTable(2))
+	L.Push(newLuaHost(L, h))
+	return 1
+}
+
+func xsHostRemoveFunc(L *lua.LState) int {
+	name := L.CheckString(1)
+	L.Push(lua.LBool(getConfigFromLState(L).RemoveHost(name)))
+	return 1
+}
+
+func xsHostRenameFunc(L *lua.LState) int {
+	name := L.CheckString(1)
+	newName := L.CheckString(2)
+	if err := getConfigFromLState(L).RenameHost(name, newName); err != nil {
+		L.RaiseError("failed to rename host: %v", err)
+	}
+	return 0
+}
+
+// amendHost merges the parameters into the host. The merge rules are the following:
+//   - ssh_config: entries are merged. An entry overrides the existing one with the same keyword ignoring case.
+//   - hooks like on_before_connect and tunnels: entries are appended to the existing ones.
+//   - tags and extends: entries are appended to the existing ones.
+//   - other parameters: they are replaced.
+func amendHost(L *lua.LState, h *Host, tb *lua.LTable) {
+	// The parameters are parsed into a temporary host in the same way as defining a host.
+	amended := &Host{Name: h.Name, SSHConfig: map[string]string{}}
+	keys := make([]string, 0)
+	tb.ForEach(func(k, v lua.LValue) {
+		if key := lua.LVAsString(k); key != "" {
+			if err := setHostParam(L, amended, key, v); err != nil {
+				L.RaiseError("failed to parse host config: %v", err)
+			}
+			keys = append(keys, key)
+		}
+	})
+
+	for _, key := range keys {
+		switch key {
+		case "name":
+			h.Name = amended.Name
+		case "description":
+			h.Description = amended.Description
+		case "hidden":
+			h.Hidden = amended.Hidden
+		case "match":
+			h.Match = amended.Match
+		case "tags":
+			h.Tags = appendUnique(h.Tags, amended.Tags...)
+		case "extends":
+			h.Extends = appendUnique(h.Extends, amended.Extends...)
+		case "ssh_config":
+			for k, v := range amended.SSHConfig {
+				for existing := range h.SSHConfig {
+					if strings.EqualFold(existing, k) {
+						delete(h.SSHConfig, existing)
+					}
+				}
+				h.SSHConfig[k] = v
+			}
+		case "on_before_connect":
+			h.OnBeforeConnect = append(h.OnBeforeConnect, amended.OnBeforeConnect...)
+		case "on_after_connect":
+			h.OnAfterConnect = append(h.OnAfterConnect, amended.OnAfterConnect...)
+		case "on_after_disconnect":
+			h.OnAfterDisconnect = append(h.OnAfterDisconnect, amended.OnAfterDisconnect...)
+		case "on_before_command":
+			h.OnBeforeCommand = append(h.OnBeforeCommand, amended.OnBeforeCommand...)
+		case "on_after_command":
+			h.OnAfterCommand = append(h.OnAfterCommand, amended.OnAfterCommand...)
+		case "tunnels":
+			h.Tunnels = append(h.Tunnels, amended.Tunnels...)
+		}
+	}
+}
+
+func appendUnique(values []string, others ...string) []string {
+	for _, v := range others {
+		if !slices.Contains(values, v) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// RemoveHost removes the host by the name. It reports whether the host existed.
+func (cfg *Config) RemoveHost(name string) bool {
+	for i, h := range cfg.Hosts {
+		if h.Name == name {
+			cfg.Hosts = slices.Delete(cfg.Hosts, i, i+1)
+			return true
+		}
+	}
+	return false
+}
+
+// RenameHost renames the host. The new name must not be used by another host.
+func (cfg *Config) RenameHost(name string, newName string) error {
+	h := cfg.NewHostFilter().GetHostByName(name)
+	if h == nil {
+		return fmt.Errorf("host %s is not defined", name)
+	}
+	if name != newName && cfg.NewHostFilter().GetHostByName(newName) != nil {
+		return fmt.Errorf("host %s already registered", newName)
+	}
+	h.Name = newName
+	return nil
+}
@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yuin/gopher-lua"
+	"testing"
+)
+
+func TestHostFunctions(t *testing.T) {
+	t.Run("amend", func(t *testing.T) {
+		L := newLState()
+		defer L.Close()
+
+		err := L.DoString(`
+host "web1" {
+  description = "shared",
+  tags = { "prod" },
+  ssh_config = {
+    HostName = "web1.example.com",
+    User = "deploy",
+  },
+  on_before_connect = { "echo shared" },
+}
+
+host.amend "web1" {
+  description = "local",
+  tags = { "prod", "web" },
+  ssh_config = {
+    user = "me",
+    IdentityFile = "~/.ssh/id_me",
+  },
+  on_before_connect = { "echo local" },
+}
+
+host.amend("web1", { hidden = true })
+assert_hidden = host.get("web1").hidden
+assert_missing = host.get("web2")
+`)
+		require.NoError(t, err)
+
+		cfg := getConfigFromLState(L)
+		h := cfg.NewHostFilter().GetHostByName("web1")
+		assert.Equal(t, "local", h.Description)
+		assert.True(t, h.Hidden)
+		assert.Equal(t, []string{"prod", "web"}, h.Tags)
+		assert.Equal(t, map[string]string{
+			"HostName":     "web1.example.com",
+			"user":         "me",
+			"IdentityFile": "~/.ssh/id_me",
+		}, h.SSHConfig)
+		assert.Equal(t, []any{lua.LString("echo shared"), lua.LString("echo local")}, h.OnBeforeConnect)
+		assert.Equal(t, lua.LTrue, L.GetGlobal("assert_hidden"))
+		assert.Equal(t, lua.LNil, L.GetGlobal("assert_missing"))
+	})
+
+	t.Run("remove and rename", func(t *testing.T) {
+		L := newLState()
+		defer L.Close()
+
+		err := L.DoString(`
+host "web1" {}
+host "web2" {}
+host "db1" {}
+
+assert_removed = host.remove("web2")
+assert_not_removed = host.remove("web3")
+host.rename("db1", "db-primary")
+`)
+		require.NoError(t, err)
+
+		cfg := getConfigFromLState(L)
+		names := make([]string, 0)
+		for _, h := range cfg.Hosts {
+			names = append(names, h.Name)
+		}
+		assert.Equal(t, []string{"web1", "db-primary"}, names)
+		assert.Equal(t, lua.LTrue, L.GetGlobal("assert_removed"))
+		assert.Equal(t, lua.LFalse, L.GetGlobal("assert_not_removed"))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, code := range []string{
+			`host.amend "web2" { description = "x" }`,
+			`host.rename("web2", "web3")`,
+			`host "web3" {}; host.rename("web1", "web3")`,
+		} {
+			L := newLState()
+			require.NoError(t, L.DoString(`host "web1" {}`))
+			assert.Error(t, L.DoString(code), code)
+			L.Close()
+		}
+	})
+}
+
+func TestHostTable(t *testing.T) {
+	L := newLState()
+	defer L.Close()
+
+	err := L.DoString(`
+host { name = "web1", description = "web", ssh_config = { HostName = "192.168.0.1" } }
+host({ name = "web2" })
+`)
+	require.NoError(t, err)
+
+	cfg := getConfigFromLState(L)
+	require.Len(t, cfg.Hosts, 2)
+	assert.Equal(t, "web1", cfg.Hosts[0].Name)
+	assert.Equal(t, "web", cfg.Hosts[0].Description)
+	assert.Equal(t, map[string]string{"HostName": "192.168.0.1"}, cfg.Hosts[0].SSHConfig)
+	assert.Equal(t, "web2", cfg.Hosts[1].Name)
+
+	assert.Error(t, L.DoString(`host { description = "no name" }`))
+}
@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/yuin/gopher-lua"
+	"slices"
+	"strings"
+)
+
+// xsHostTemplateFunc defines a host template.
+// A host template accepts the same parameters as a host, but it does not produce a "Host" section in the ssh_config.
+// Hosts (and other templates) inherit the template by the "extends" parameter.
+func xsHostTemplateFunc(L *lua.LState) int {
+	l := L.GetTop()
+	if l == 1 {
+		// DSL style like `host_template "name" { ... }`
+		name := L.CheckString(1)
+		t, err := registerNewHostTemplate(L, name)
+		if err != nil {
+			L.RaiseError("failed to register new host template: %v", err)
+		}
+		L.Push(newLuaHost(L, t))
+	} else if l == 2 {
+		// function style like `host_template("name", { ... })`
+		name := L.CheckString(1)
+		tb := L.CheckTable(2)
+		t, err := registerNewHostTemplate(L, name)
+		if err != nil {
+			L.RaiseError("failed to register new host template: %v", err)
+		}
+		tb.ForEach(func(k, v lua.LValue) {
+			if key := lua.LVAsString(k); key != "" {
+				if err := setHostParam(L, t, key, v); err != nil {
+					L.RaiseError("failed to parse host template config: %v", err)
+				}
+			}
+		})
+		L.Push(newLuaHost(L, t))
+	} else {
+		L.RaiseError("invalid number of arguments. want 1 or 2, got %d", l)
+	}
+	return 1
+}
+
+func registerNewHostTemplate(L *lua.LState, name string) (*Host, error) {
+	cfg := getConfigFromLState(L)
+	t := &Host{
+		Name:      name,
+		SSHConfig: map[string]string{},
+		pos:       luaCallerPos(L),
+		file:      cfg.loadingFile,
+	}
+
+	if err := cfg.AddTemplate(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// resolveHostTemplates merges the templates into the hosts that extend them.
+// It must be called once after the config file is loaded.
+//
+// The templates a host extends are merged in the order of "extends", and the templates a template extends
+// are merged before the template itself. Each template is merged only once even if it is reached multiple times.
+// The merge rules are the following:
+//   - ssh_config: entries of the templates are inherited. If the same key is defined in multiple places,
+//     the host wins over the templates, and a later template wins over an earlier one.
+//   - hooks like on_before_connect: hooks of the templates run before the hooks of the host.
+//   - tags: tags of the templates are added to the host.
+//   - description and hidden: they are not inherited.
+func (cfg *Config) resolveHostTemplates() error {
+	for _, t := range cfg.Templates {
+		if _, err := cfg.linearizeHostTemplates(t.Name, t.Extends, []string{t.Name}, nil); err != nil {
+			return err
+		}
+	}
+	for _, h := range cfg.Hosts {
+		templates, err := cfg.linearizeHostTemplates(h.Name, h.Extends, []string{}, nil)
+		if err != nil {
+			return err
+		}
+		mergeHostTemplates(h, templates)
+	}
+	return nil
+}
+
+// linearizeHostTemplates returns the templates to merge in order, including the ancestors of the templates.
+// The chain holds the names of the templates being resolved to detect circular inheritance.
+func (cfg *Config) linearizeHostTemplates(owner string, names []string, chain []string, templates []*Host) ([]*Host, error) {
+	for _, name := range names {
+		if slices.Contains(chain, name) {
+			return nil, fmt.Errorf("circular host template inheritance: %s -> %s", strings.Join(chain, " -> "), name)
+		}
+		t := cfg.GetTemplateByName(name)
+		if t == nil {
+			return nil, fmt.Errorf("%s extends undefined host template %s", owner, name)
+		}
+		var err error
+		templates, err = cfg.linearizeHostTemplates(t.Name, t.Extends, append(chain, name), templates)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(templates, t) {
+			templates = append(templates, t)
+		}
+	}
+	return templates, nil
+}
+
+func mergeHostTemplates(h *Host, templates []*Host) {
+	if len(templates) == 0 {
+		return
+	}
+
+	sshConfig := map[string]string{}
+	var onBeforeConnect, onAfterConnect, onAfterDisconnect, onBeforeCommand, onAfterCommand []any
+	var tags []string
+	var tunnels []*Tunnel
+	for _, t := range append(templates, h) {
+		// ssh_config keywords are case-insensitive, so the later one overrides the key in any case.
+		// The keys defined in different cases by the same host are kept to be reported by "xs check".
+		for k := range t.SSHConfig {
+			for existing := range sshConfig {
+				if strings.EqualFold(existing, k) {
+					delete(sshConfig, existing)
+				}
+			}
+		}
+		for k, v := range t.SSHConfig {
+			sshConfig[k] = v
+		}
+		onBeforeConnect = append(onBeforeConnect, t.OnBeforeConnect...)
+		onAfterConnect = append(onAfterConnect, t.OnAfterConnect...)
+		onAfterDisconnect = append(onAfterDisconnect, t.OnAfterDisconnect...)
+		onBeforeCommand = append(onBeforeCommand, t.OnBeforeCommand...)
+		onAfterCommand = append(onAfterCommand, t.OnAfterCommand...)
+		tunnels = append(tunnels, t.Tunnels...)
+		for _, tag := range t.Tags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	h.SSHConfig = sshConfig
+	h.OnBeforeConnect = onBeforeConnect
+	h.OnAfterConnect = onAfterConnect
+	h.OnAfterDisconnect = onAfterDisconnect
+	h.OnBeforeCommand = onBeforeCommand
+	h.OnAfterCommand = onAfterCommand
+	h.Tags = tags
+	h.Tunnels = tunnels
+}
@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestResolveHostTemplates(t *testing.T) {
+	t.Run("merge templates", func(t *testing.T) {
+		L := newLState()
+		defer L.Close()
+
+		err := L.DoString(`
+host "web1" {
+  extends = { "base", "web" },
+  tags = { "web1" },
+  ssh_config = {
+    HostName = "web1.example.com",
+    Port = "2222",
+  },
+  on_before_connect = { "echo web1" },
+}
+
+host_template "base" {
+  tags = { "prod" },
+  ssh_config = {
+    User = "base-user",
+    Port = "22",
+    IdentityFile = "~/.ssh/id_base",
+  },
+  on_before_connect = { "echo base" },
+}
+
+host_template "web" {
+  extends = "base",
+  tags = { "web" },
+  ssh_config = {
+    User = "web-user",
+  },
+  on_before_connect = { "echo web" },
+}
+`)
+		assert.NoError(t, err)
+
+		cfg := getConfigFromLState(L)
+		assert.NoError(t, cfg.resolveHostTemplates())
+
+		h := cfg.NewHostFilter().GetHostByName("web1")
+		assert.Equal(t, map[string]string{
+			"HostName":     "web1.example.com",
+			"Port":         "2222",
+			"User":         "web-user",
+			"IdentityFile": "~/.ssh/id_base",
+		}, h.SSHConfig)
+		assert.Equal(t, []string{"prod", "web", "web1"}, h.Tags)
+
+		script, err := createHookScript(L, h.OnBeforeConnect)
+		assert.NoError(t, err)
+		assert.Equal(t, "echo base\necho web\necho web1", script)
+	})
+
+	t.Run("ssh_config keys are case-insensitive", func(t *testing.T) {
+		L := newLState()
+		defer L.Close()
+
+		err := L.DoString(`
+host "web1" {
+  extends = "web",
+  ssh_config = { user = "root" },
+}
+
+host_template "base" {
+  ssh_config = { USER = "base-user", port = "22" },
+}
+
+host_template "web" {
+  extends = "base",
+  ssh_config = { User = "deploy", Port = "2222" },
+}
+`)
+		assert.NoError(t, err)
+
+		cfg := getConfigFromLState(L)
+		assert.NoError(t, cfg.resolveHostTemplates())
+
+		h := cfg.NewHostFilter().GetHostByName("web1")
+		assert.Equal(t, map[string]string{
+			"user": "root",
+			"Port": "2222",
+		}, h.SSHConfig)
+	})
+
+	t.Run("undefined template", func(t *testing.T) {
+		L := newLState()
+		defer L.Close()
+
+		err := L.DoString(`host "web1" { extends = "unknown" }`)
+		assert.NoError(t, err)
+		assert.EqualError(t, getConfigFromLState(L).resolveHostTemplates(), "web1 extends undefined host template unknown")
+	})
+
+	t.Run("circular inheritance", func(t *testing.T) {
+		L := newLState()
+		defer L.Close()
+
+		err := L.DoString(`
+host_template "a" { extends = "b" }
+host_template "b" { extends = "c" }
+host_template "c" { extends = "b" }
+`)
+		assert.NoError(t, err)
+		assert.EqualError(t, getConfigFromLState(L).resolveHostTemplates(), "circular host template inheritance: a -> b -> c -> b")
+	})
+}
@@ -15,6 +15,42 @@ func (f *HostFilter) ExcludeHidden() *HostFilter {
 	return f
 }
 
+// ExcludePatterns removes the pattern hosts and keeps only the concrete hosts.
+func (f *HostFilter) ExcludePatterns() *HostFilter {
+	hosts := make([]*Host, 0)
+	for _, h := range f.hosts {
+		if !h.IsPattern() {
+			hosts = append(hosts, h)
+		}
+	}
+	f.hosts = hosts
+	return f
+}
+
+// MatchHostname keeps only the hosts whose "Host" sections apply to the hostname.
+func (f *HostFilter) MatchHostname(hostname string) *HostFilter {
+	hosts := make([]*Host, 0)
+	for _, h := range f.hosts {
+		if h.MatchesHostname(hostname) {
+			hosts = append(hosts, h)
+		}
+	}
+	f.hosts = hosts
+	return f
+}
+
+// Select keeps only the hosts selected by the selector.
+func (f *HostFilter) Select(selector *HostSelector) *HostFilter {
+	hosts := make([]*Host, 0)
+	for _, h := range f.hosts {
+		if selector.Match(h) {
+			hosts = append(hosts, h)
+		}
+	}
+	f.hosts = hosts
+	return f
+}
+
 func (f *HostFilter) GetHosts() []*Host {
 	return f.hosts
 }
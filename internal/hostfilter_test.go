@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func hostNames(hosts []*Host) []string {
+	names := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		names = append(names, h.Name)
+	}
+	return names
+}
+
+func TestHostFilter_Select(t *testing.T) {
+	cfg := &Config{
+		Hosts: []*Host{
+			{Name: "web1"},
+			{Name: "web2"},
+			{Name: "db1"},
+			{Name: "web3", Hidden: true},
+		},
+	}
+
+	assert.Equal(t, []string{"web1", "web2", "web3"}, hostNames(cfg.NewHostFilter().Select(mustParseHostSelector(t, "web*")).GetHosts()))
+	assert.Equal(t, []string{"web1", "web2"}, hostNames(cfg.NewHostFilter().ExcludeHidden().Select(mustParseHostSelector(t, "web*")).GetHosts()))
+	assert.Equal(t, []string{"web1", "db1"}, hostNames(cfg.NewHostFilter().Select(mustParseHostSelector(t, "db1,web1")).GetHosts()))
+	assert.Equal(t, []string{}, hostNames(cfg.NewHostFilter().Select(mustParseHostSelector(t, "app*")).GetHosts()))
+}
+
+func mustParseHostSelector(t *testing.T, expr string) *HostSelector {
+	s, err := ParseHostSelector(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
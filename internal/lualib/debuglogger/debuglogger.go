@@ -1,8 +1,8 @@
 package debuglogger
 
 import (
-	"fmt"
 	"github.com/kohkimakimoto/xs/internal/debuglogger"
+	"github.com/kohkimakimoto/xs/internal/lualib/luavalue"
 	"github.com/yuin/gopher-lua"
 )
 
@@ -28,7 +28,7 @@ func printf(l *debuglogger.Logger) lua.LGFunction {
 				format = L.CheckString(i)
 				continue
 			}
-			values = append(values, toGoValue(L.Get(i)))
+			values = append(values, luavalue.ToGoValue(L.Get(i)))
 		}
 		l.Printf(format, values...)
 		return 0
@@ -45,40 +45,9 @@ func printfNoPrefix(l *debuglogger.Logger) lua.LGFunction {
 				format = L.CheckString(i)
 				continue
 			}
-			values = append(values, toGoValue(L.Get(i)))
+			values = append(values, luavalue.ToGoValue(L.Get(i)))
 		}
 		l.PrintfNoPrefix(format, values...)
 		return 0
 	}
 }
-
-func toGoValue(lv lua.LValue) any {
-	switch v := lv.(type) {
-	case *lua.LNilType:
-		return nil
-	case lua.LBool:
-		return bool(v)
-	case lua.LString:
-		return string(v)
-	case lua.LNumber:
-		return float64(v)
-	case *lua.LTable:
-		maxn := v.MaxN()
-		if maxn == 0 { // table
-			ret := make(map[string]any)
-			v.ForEach(func(key, value lua.LValue) {
-				keystr := fmt.Sprint(toGoValue(key))
-				ret[keystr] = toGoValue(value)
-			})
-			return ret
-		} else { // array
-			ret := make([]any, 0, maxn)
-			for i := 1; i <= maxn; i++ {
-				ret = append(ret, toGoValue(v.RawGetInt(i)))
-			}
-			return ret
-		}
-	default:
-		return v
-	}
-}
@@ -0,0 +1,302 @@
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ansibleSSHConfigVars maps the Ansible connection variables to the ssh_config keywords.
+var ansibleSSHConfigVars = map[string]string{
+	"ansible_host":                 "HostName",
+	"ansible_ssh_host":             "HostName",
+	"ansible_port":                 "Port",
+	"ansible_ssh_port":             "Port",
+	"ansible_user":                 "User",
+	"ansible_ssh_user":             "User",
+	"ansible_ssh_private_key_file": "IdentityFile",
+}
+
+type ansibleGroup struct {
+	name    string
+	hosts   []string
+	vars    map[string]string
+	parents []string
+}
+
+// parseAnsibleINI parses an Ansible inventory file in the INI format.
+// The groups of a host become its tags, and the connection variables like "ansible_host" become its ssh_config.
+// The variables of a host take precedence over the variables of its groups, and the variables of a child group
+// take precedence over the variables of its parent groups like Ansible.
+func parseAnsibleINI(data []byte) ([]map[string]any, error) {
+	groups := map[string]*ansibleGroup{}
+	getGroup := func(name string) *ansibleGroup {
+		g, ok := groups[name]
+		if !ok {
+			g = &ansibleGroup{name: name, vars: map[string]string{}}
+			groups[name] = g
+		}
+		return g
+	}
+
+	hostNames := make([]string, 0)
+	hostVars := map[string]map[string]string{}
+
+	group := getGroup("ungrouped")
+	section := "hosts"
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := line[1 : len(line)-1]
+			section = "hosts"
+			if n, s, ok := strings.Cut(name, ":"); ok {
+				name, section = n, s
+			}
+			if section != "hosts" && section != "vars" && section != "children" {
+				return nil, fmt.Errorf("line %d: invalid section: %s", lineNum, line)
+			}
+			group = getGroup(name)
+			continue
+		}
+
+		fields, err := splitAnsibleFields(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		switch section {
+		case "hosts":
+			names, err := expandAnsibleHostPattern(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			for _, name := range names {
+				if _, ok := hostVars[name]; !ok {
+					hostNames = append(hostNames, name)
+					hostVars[name] = map[string]string{}
+				}
+				for _, field := range fields[1:] {
+					if k, v, ok := strings.Cut(field, "="); ok {
+						hostVars[name][k] = v
+					}
+				}
+				if !slices.Contains(group.hosts, name) {
+					group.hosts = append(group.hosts, name)
+				}
+			}
+		case "vars":
+			k, v, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, fmt.Errorf("line %d: invalid variable: %s", lineNum, line)
+			}
+			group.vars[strings.TrimSpace(k)] = strings.Trim(strings.TrimSpace(v), `"'`)
+		case "children":
+			child := getGroup(fields[0])
+			child.parents = append(child.parents, group.name)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	hosts := make([]map[string]any, 0, len(hostNames))
+	for _, name := range hostNames {
+		hostGroups := ansibleHostGroups(groups, name)
+
+		vars := map[string]string{}
+		if all, ok := groups["all"]; ok {
+			for k, v := range all.vars {
+				vars[k] = v
+			}
+		}
+		tags := make([]any, 0)
+		for _, g := range hostGroups {
+			for k, v := range g.vars {
+				vars[k] = v
+			}
+			if g.name != "all" && g.name != "ungrouped" {
+				tags = append(tags, g.name)
+			}
+		}
+		for k, v := range hostVars[name] {
+			vars[k] = v
+		}
+
+		h := map[string]any{"name": name}
+		if len(tags) > 0 {
+			h["tags"] = tags
+		}
+		sshConfig := map[string]any{}
+		for k, v := range vars {
+			if keyword, ok := ansibleSSHConfigVars[k]; ok {
+				sshConfig[keyword] = v
+			}
+		}
+		if len(sshConfig) > 0 {
+			h["ssh_config"] = sshConfig
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, nil
+}
+
+// ansibleHostGroups returns the groups the host belongs to including their ancestors.
+// The groups are sorted by the depth, parents first, and then by the names.
+func ansibleHostGroups(groups map[string]*ansibleGroup, host string) []*ansibleGroup {
+	depths := map[string]int{}
+	var depth func(g *ansibleGroup, chain []string) int
+	depth = func(g *ansibleGroup, chain []string) int {
+		if d, ok := depths[g.name]; ok {
+			return d
+		}
+		d := 0
+		for _, p := range g.parents {
+			if slices.Contains(chain, p) {
+				continue
+			}
+			d = max(d, depth(groups[p], append(chain, g.name))+1)
+		}
+		depths[g.name] = d
+		return d
+	}
+
+	found := map[string]*ansibleGroup{}
+	var addWithParents func(g *ansibleGroup)
+	addWithParents = func(g *ansibleGroup) {
+		if _, ok := found[g.name]; ok {
+			return
+		}
+		found[g.name] = g
+		for _, p := range g.parents {
+			addWithParents(groups[p])
+		}
+	}
+	for _, g := range groups {
+		if slices.Contains(g.hosts, host) {
+			addWithParents(g)
+		}
+	}
+
+	ret := make([]*ansibleGroup, 0, len(found))
+	for _, g := range found {
+		ret = append(ret, g)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		di, dj := depth(ret[i], nil), depth(ret[j], nil)
+		if di != dj {
+			return di < dj
+		}
+		return ret[i].name < ret[j].name
+	})
+	return ret
+}
+
+// splitAnsibleFields splits a line into the fields separated by whitespace. Quoted values are unquoted.
+func splitAnsibleFields(line string) ([]string, error) {
+	fields := make([]string, 0)
+	var b strings.Builder
+	var quote rune
+	inField := false
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				b.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inField = true
+		case r == ' ' || r == '\t':
+			if inField {
+				fields = append(fields, b.String())
+				b.Reset()
+				inField = false
+			}
+		case r == '#' && !inField:
+			// the rest of the line is a comment
+			return fields, nil
+		default:
+			b.WriteRune(r)
+			inField = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote: %s", line)
+	}
+	if inField {
+		fields = append(fields, b.String())
+	}
+	return fields, nil
+}
+
+// expandAnsibleHostPattern expands the ranges in a host pattern like "web[01:03].example.com" or "db-[a:c]".
+// A range can have a step like "[1:10:2]".
+func expandAnsibleHostPattern(pattern string) ([]string, error) {
+	start := strings.Index(pattern, "[")
+	if start < 0 {
+		return []string{pattern}, nil
+	}
+	end := strings.Index(pattern[start:], "]")
+	if end < 0 {
+		return nil, fmt.Errorf("invalid host range: %s", pattern)
+	}
+	end += start
+
+	parts := strings.Split(pattern[start+1:end], ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("invalid host range: %s", pattern)
+	}
+	step := 1
+	if len(parts) == 3 {
+		var err error
+		if step, err = strconv.Atoi(parts[2]); err != nil || step <= 0 {
+			return nil, fmt.Errorf("invalid host range: %s", pattern)
+		}
+	}
+
+	values := make([]string, 0)
+	if from, err := strconv.Atoi(parts[0]); err == nil {
+		to, err := strconv.Atoi(parts[1])
+		if err != nil || to < from {
+			return nil, fmt.Errorf("invalid host range: %s", pattern)
+		}
+		// "01" keeps the width with leading zeros
+		width := 0
+		if len(parts[0]) > 1 && strings.HasPrefix(parts[0], "0") {
+			width = len(parts[0])
+		}
+		for i := from; i <= to; i += step {
+			values = append(values, fmt.Sprintf("%0*d", width, i))
+		}
+	} else if len(parts[0]) == 1 && len(parts[1]) == 1 && parts[0] <= parts[1] {
+		for c := int(parts[0][0]); c <= int(parts[1][0]); c += step {
+			values = append(values, string(rune(c)))
+		}
+	} else {
+		return nil, fmt.Errorf("invalid host range: %s", pattern)
+	}
+
+	ret := make([]string, 0)
+	for _, v := range values {
+		rest, err := expandAnsibleHostPattern(pattern[end+1:])
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rest {
+			ret = append(ret, pattern[:start]+v+r)
+		}
+	}
+	return ret, nil
+}
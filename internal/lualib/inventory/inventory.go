@@ -0,0 +1,393 @@
+package inventory
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/kohkimakimoto/xs/internal/lualib/luavalue"
+	"github.com/yuin/gopher-lua"
+	"gopkg.in/yaml.v3"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Tracker is notified of the sources that the loaded hosts depend on.
+// It is used to expire the cache of the evaluated config.
+type Tracker interface {
+	// AddDependency adds the file that the hosts depend on.
+	AddDependency(file string)
+	// SetTTL sets the time to live of the hosts from a dynamic source. Zero means that they must not be cached.
+	SetTTL(ttl time.Duration)
+}
+
+// Loader returns the loader of the "xs.inventory" module that loads hosts from external sources.
+// The loaded hosts are cached in the cacheDir when the "cache" option is specified.
+// The tracker can be nil.
+func Loader(cacheDir string, tracker Tracker) lua.LGFunction {
+	return func(L *lua.LState) int {
+		tb := L.NewTable()
+		L.SetFuncs(tb, map[string]lua.LGFunction{
+			"load":    load(cacheDir, tracker),
+			"command": command(cacheDir, tracker),
+		})
+		L.Push(tb)
+		return 1
+	}
+}
+
+// options is the options of the functions in the module.
+type options struct {
+	// Format is the format of the source: "json", "yaml", "toml", "csv" or "ini" (Ansible inventory).
+	Format string
+	// Cache is the time to live of the cached hosts. The hosts are not cached if it is zero.
+	Cache time.Duration
+}
+
+func checkOptions(L *lua.LState, n int) *options {
+	opts := &options{}
+	tb := L.OptTable(n, L.NewTable())
+	opts.Format = lua.LVAsString(tb.RawGetString("format"))
+	if v, ok := tb.RawGetString("cache").(lua.LNumber); ok {
+		opts.Cache = time.Duration(float64(v) * float64(time.Second))
+	}
+	return opts
+}
+
+// load loads hosts from a file like `inventory.load("hosts.json")`.
+// The format is detected by the extension of the file if the "format" option is not specified.
+// A relative path is resolved from the directory of the config file.
+func load(cacheDir string, tracker Tracker) lua.LGFunction {
+	return func(L *lua.LState) int {
+		path := L.CheckString(1)
+		opts := checkOptions(L, 2)
+
+		if !filepath.IsAbs(path) {
+			if xs, ok := L.GetGlobal("xs").(*lua.LTable); ok {
+				if dir := lua.LVAsString(xs.RawGetString("config_dir")); dir != "" {
+					path = filepath.Join(dir, path)
+				}
+			}
+		}
+		if opts.Format == "" {
+			opts.Format = formatFromExt(path)
+		}
+		if tracker != nil {
+			tracker.AddDependency(path)
+		}
+
+		hosts, err := cached(cacheDir, "file:"+opts.Format+":"+path, opts.Cache, path, func() ([]map[string]any, error) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			return parse(data, opts.Format)
+		})
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(fmt.Sprintf("failed to load inventory %s: %v", path, err)))
+			return 2
+		}
+		L.Push(toLuaHosts(L, hosts))
+		return 1
+	}
+}
+
+// command loads hosts from the stdout of a command like `inventory.command("./hosts.sh", { format = "json" })`.
+// The default format is "json".
+func command(cacheDir string, tracker Tracker) lua.LGFunction {
+	return func(L *lua.LState) int {
+		cmd := L.CheckString(1)
+		opts := checkOptions(L, 2)
+		if opts.Format == "" {
+			opts.Format = "json"
+		}
+		if tracker != nil {
+			// The output of the command can change at any time, so the hosts are cached only for the TTL.
+			tracker.SetTTL(opts.Cache)
+		}
+
+		hosts, err := cached(cacheDir, "command:"+opts.Format+":"+cmd, opts.Cache, "", func() ([]map[string]any, error) {
+			out, err := runCommand(cmd)
+			if err != nil {
+				return nil, err
+			}
+			return parse(out, opts.Format)
+		})
+		if err != nil {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(fmt.Sprintf("failed to load inventory from command %q: %v", cmd, err)))
+			return 2
+		}
+		L.Push(toLuaHosts(L, hosts))
+		return 1
+	}
+}
+
+func runCommand(command string) ([]byte, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/c", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func formatFromExt(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	case ".csv":
+		return "csv"
+	default:
+		// Ansible inventory files often have no extension like "hosts"
+		return "ini"
+	}
+}
+
+// cached returns the hosts from the cache if it is fresh, or loads them and caches them.
+// The cache of a file is also expired when the file is modified.
+func cached(cacheDir string, key string, ttl time.Duration, file string, fn func() ([]map[string]any, error)) ([]map[string]any, error) {
+	if ttl <= 0 || cacheDir == "" {
+		return fn()
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	cacheFile := filepath.Join(cacheDir, "inventory", hex.EncodeToString(sum[:])+".json")
+	if info, err := os.Stat(cacheFile); err == nil && time.Since(info.ModTime()) < ttl {
+		fresh := true
+		if file != "" {
+			if fileInfo, err := os.Stat(file); err != nil || fileInfo.ModTime().After(info.ModTime()) {
+				fresh = false
+			}
+		}
+		if data, err := os.ReadFile(cacheFile); err == nil && fresh {
+			var hosts []map[string]any
+			if err := json.Unmarshal(data, &hosts); err == nil {
+				return hosts, nil
+			}
+		}
+	}
+
+	hosts, err := fn()
+	if err != nil {
+		return nil, err
+	}
+	// Failing to write the cache is not an error because it only makes the next load slower.
+	_ = writeCacheFile(cacheFile, hosts)
+	return hosts, nil
+}
+
+func writeCacheFile(cacheFile string, hosts []map[string]any) error {
+	data, err := json.Marshal(hosts)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(cacheFile), ".tmp.*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), cacheFile)
+}
+
+// parse parses the data into the list of hosts. Each host is a map that has the parameters of a host like
+// "name", "description", "tags" and "ssh_config".
+func parse(data []byte, format string) ([]map[string]any, error) {
+	var v any
+	switch format {
+	case "json":
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+	case "yaml":
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+	case "toml":
+		m := map[string]any{}
+		if err := toml.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		v = m
+	case "csv":
+		return parseCSV(data)
+	case "ini":
+		return parseAnsibleINI(data)
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+	return normalizeHosts(v)
+}
+
+// normalizeHosts converts the decoded data into the list of hosts. The data is one of the following:
+//   - an array of hosts that have "name".
+//   - a map of the host names to the hosts. The hosts are sorted by the names.
+//   - a map that has the "hosts" key whose value is one of the above.
+func normalizeHosts(v any) ([]map[string]any, error) {
+	if m, ok := normalizeMap(v); ok {
+		if inner, ok := m["hosts"]; ok {
+			v = inner
+		}
+	}
+
+	hosts := make([]map[string]any, 0)
+	if m, ok := normalizeMap(v); ok {
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			h := map[string]any{}
+			if m[name] != nil {
+				var ok bool
+				if h, ok = normalizeMap(m[name]); !ok {
+					return nil, fmt.Errorf("host %s must be a map", name)
+				}
+			}
+			h["name"] = name
+			hosts = append(hosts, h)
+		}
+		return hosts, nil
+	}
+
+	if tables, ok := v.([]map[string]any); ok {
+		// TOML decodes an array of tables like [[hosts]] into []map[string]any
+		list := make([]any, 0, len(tables))
+		for _, t := range tables {
+			list = append(list, t)
+		}
+		v = list
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("hosts must be an array or a map")
+	}
+	for i, item := range list {
+		h, ok := normalizeMap(item)
+		if !ok {
+			return nil, fmt.Errorf("host #%d must be a map", i+1)
+		}
+		if name, ok := h["name"].(string); !ok || name == "" {
+			return nil, fmt.Errorf("host #%d has no name", i+1)
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, nil
+}
+
+func normalizeMap(v any) (map[string]any, bool) {
+	switch m := v.(type) {
+	case map[string]any:
+		return m, true
+	case map[any]any:
+		ret := make(map[string]any, len(m))
+		for k, v := range m {
+			ret[fmt.Sprint(k)] = v
+		}
+		return ret, true
+	}
+	return nil, false
+}
+
+// parseCSV parses CSV that has a header row. The columns "name", "description", "hidden", "match", "tags" and
+// "extends" are the host parameters, and the other columns are the ssh_config keywords.
+// "tags" and "extends" are separated by commas or whitespace. Empty cells are ignored.
+func parseCSV(data []byte) ([]map[string]any, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return []map[string]any{}, nil
+	}
+
+	header := records[0]
+	hosts := make([]map[string]any, 0, len(records)-1)
+	for i, record := range records[1:] {
+		h := map[string]any{}
+		sshConfig := map[string]any{}
+		for j, cell := range record {
+			if cell == "" {
+				continue
+			}
+			column := strings.TrimSpace(header[j])
+			switch column {
+			case "name", "description", "match":
+				h[column] = cell
+			case "hidden":
+				h[column] = parseBool(cell)
+			case "tags", "extends":
+				h[column] = splitList(cell)
+			default:
+				sshConfig[column] = cell
+			}
+		}
+		if _, ok := h["name"]; !ok {
+			return nil, fmt.Errorf("host #%d has no name", i+1)
+		}
+		if len(sshConfig) > 0 {
+			h["ssh_config"] = sshConfig
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, nil
+}
+
+func parseBool(s string) bool {
+	switch strings.ToLower(s) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+func splitList(s string) []any {
+	ret := make([]any, 0)
+	for _, v := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	}) {
+		ret = append(ret, v)
+	}
+	return ret
+}
+
+func toLuaHosts(L *lua.LState, hosts []map[string]any) *lua.LTable {
+	tb := L.NewTable()
+	for _, h := range hosts {
+		tb.Append(luavalue.ToLuaValue(L, h))
+	}
+	return tb
+}
@@ -0,0 +1,167 @@
+package inventory
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yuin/gopher-lua"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	expected := []map[string]any{
+		{"name": "db1", "ssh_config": map[string]any{"HostName": "10.0.0.2"}},
+		{"name": "web1", "tags": []any{"web"}, "ssh_config": map[string]any{"HostName": "10.0.0.1"}},
+	}
+
+	for _, tt := range []struct {
+		format string
+		data   string
+	}{
+		{"json", `[
+  {"name": "db1", "ssh_config": {"HostName": "10.0.0.2"}},
+  {"name": "web1", "tags": ["web"], "ssh_config": {"HostName": "10.0.0.1"}}
+]`},
+		{"json", `{"hosts": {
+  "web1": {"tags": ["web"], "ssh_config": {"HostName": "10.0.0.1"}},
+  "db1": {"ssh_config": {"HostName": "10.0.0.2"}}
+}}`},
+		{"yaml", `
+web1:
+  tags: [web]
+  ssh_config:
+    HostName: 10.0.0.1
+db1:
+  ssh_config:
+    HostName: 10.0.0.2
+`},
+		{"toml", `
+[[hosts]]
+name = "db1"
+ssh_config = { HostName = "10.0.0.2" }
+
+[[hosts]]
+name = "web1"
+tags = ["web"]
+ssh_config = { HostName = "10.0.0.1" }
+`},
+		{"csv", `name,tags,HostName
+db1,,10.0.0.2
+web1,web,10.0.0.1
+`},
+	} {
+		t.Run(tt.format, func(t *testing.T) {
+			hosts, err := parse([]byte(tt.data), tt.format)
+			require.NoError(t, err)
+			assert.Equal(t, expected, hosts)
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := parse([]byte(`[{"description": "no name"}]`), "json")
+		assert.EqualError(t, err, "host #1 has no name")
+		_, err = parse([]byte(`"web1"`), "json")
+		assert.EqualError(t, err, "hosts must be an array or a map")
+		_, err = parse([]byte(``), "xml")
+		assert.EqualError(t, err, "unsupported format: xml")
+	})
+}
+
+func TestParseAnsibleINI(t *testing.T) {
+	hosts, err := parseAnsibleINI([]byte(`
+bastion ansible_host=192.168.0.1 # comment
+
+[web]
+web[01:02].example.com ansible_user=deploy
+
+[db]
+db-[a:b] ansible_port=5432 ansible_ssh_private_key_file="/path/to/my key"
+
+[prod:children]
+web
+db
+
+[prod:vars]
+ansible_user=admin
+ansible_port=2222
+
+[all:vars]
+ansible_port=22
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]any{
+		{"name": "bastion", "ssh_config": map[string]any{"HostName": "192.168.0.1", "Port": "22"}},
+		{"name": "web01.example.com", "tags": []any{"prod", "web"}, "ssh_config": map[string]any{"User": "deploy", "Port": "2222"}},
+		{"name": "web02.example.com", "tags": []any{"prod", "web"}, "ssh_config": map[string]any{"User": "deploy", "Port": "2222"}},
+		{"name": "db-a", "tags": []any{"prod", "db"}, "ssh_config": map[string]any{"User": "admin", "Port": "5432", "IdentityFile": "/path/to/my key"}},
+		{"name": "db-b", "tags": []any{"prod", "db"}, "ssh_config": map[string]any{"User": "admin", "Port": "5432", "IdentityFile": "/path/to/my key"}},
+	}, hosts)
+}
+
+func TestExpandAnsibleHostPattern(t *testing.T) {
+	for _, tt := range []struct {
+		pattern  string
+		expected []string
+	}{
+		{"web", []string{"web"}},
+		{"web[1:3]", []string{"web1", "web2", "web3"}},
+		{"web[08:10]", []string{"web08", "web09", "web10"}},
+		{"web[1:5:2]", []string{"web1", "web3", "web5"}},
+		{"[a:b]-[1:2]", []string{"a-1", "a-2", "b-1", "b-2"}},
+	} {
+		names, err := expandAnsibleHostPattern(tt.pattern)
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, names, tt.pattern)
+	}
+
+	for _, pattern := range []string{"web[1]", "web[3:1]", "web[1:2", "web[a:10]"} {
+		_, err := expandAnsibleHostPattern(pattern)
+		assert.Error(t, err, pattern)
+	}
+}
+
+func TestLoader(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hosts.yml"), []byte("web1: { description: web }\n"), 0644))
+	counter := filepath.Join(dir, "counter")
+
+	L := lua.NewState()
+	defer L.Close()
+	L.PreloadModule("inventory", Loader(cacheDir, nil))
+	xs := L.NewTable()
+	xs.RawSetString("config_dir", lua.LString(dir))
+	L.SetGlobal("xs", xs)
+	L.SetGlobal("counter", lua.LString(counter))
+
+	err := L.DoString(`
+local inventory = require("inventory")
+
+local hosts = assert(inventory.load("hosts.yml"))
+assert(#hosts == 1)
+assert(hosts[1].name == "web1")
+assert(hosts[1].description == "web")
+
+local hosts, err = inventory.load("missing.json")
+assert(hosts == nil)
+assert(err:find("failed to load inventory"))
+
+-- the command runs once while the cache is fresh
+local command = "echo x >> " .. counter .. "; echo '[{\"name\": \"db1\", \"hidden\": true}]'"
+for i = 1, 2 do
+  local hosts = assert(inventory.command(command, { cache = 60 }))
+  assert(hosts[1].name == "db1")
+  assert(hosts[1].hidden == true)
+end
+
+local hosts, err = inventory.command("echo oops >&2; exit 1")
+assert(hosts == nil)
+assert(err:find("oops"))
+`)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(counter)
+	require.NoError(t, err)
+	assert.Equal(t, "x\n", string(data))
+}
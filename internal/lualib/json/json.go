@@ -0,0 +1,66 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/kohkimakimoto/xs/internal/lualib/luavalue"
+	"github.com/yuin/gopher-lua"
+)
+
+func Loader(L *lua.LState) int {
+	tb := L.NewTable()
+	L.SetFuncs(tb, map[string]lua.LGFunction{
+		"encode": encode,
+		"decode": decode,
+	})
+	tb.RawSetString("null", luavalue.NewNull(L))
+	L.Push(tb)
+	return 1
+}
+
+// encode encodes the value into JSON like `json.encode(value)` or `json.encode(value, { indent = "  " })`.
+// A table is encoded into an array if its keys are the sequence from 1, otherwise into an object.
+// An empty table is encoded into an empty object.
+func encode(L *lua.LState) int {
+	v, err := luavalue.ToEncodableValue(L.CheckAny(1))
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	indent := ""
+	if opts := L.OptTable(2, nil); opts != nil {
+		indent = lua.LVAsString(opts.RawGetString("indent"))
+	}
+
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(v); err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	L.Push(lua.LString(bytes.TrimSuffix(b.Bytes(), []byte("\n"))))
+	return 1
+}
+
+// decode decodes the JSON string into the value like `json.decode(str)`.
+// null is decoded into nil, so the entries whose values are null are removed from the tables,
+// except that null in an array is decoded into the null value to keep the array without holes.
+func decode(L *lua.LState) int {
+	str := L.CheckString(1)
+
+	var v any
+	if err := json.Unmarshal([]byte(str), &v); err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	L.Push(luavalue.ToLuaValue(L, v))
+	return 1
+}
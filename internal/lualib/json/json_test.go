@@ -0,0 +1,62 @@
+package json
+
+import (
+	"github.com/yuin/gopher-lua"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	L.PreloadModule("json", Loader)
+	if err := L.DoString(`
+local json = require("json")
+
+assert(json.encode({1, 2.5, "a", true}) == '[1,2.5,"a",true]')
+assert(json.encode({b = 1, a = {}}) == '{"a":{},"b":1}')
+assert(json.encode({a = json.null}) == '{"a":null}')
+assert(json.encode({1, json.null, 3}) == '[1,null,3]')
+assert(json.encode(1e6) == '1000000')
+assert(json.encode("<&>") == '"<&>"')
+assert(json.encode({a = {1}}, { indent = "  " }) == '{\n  "a": [\n    1\n  ]\n}')
+
+local str, err = json.encode({f = print})
+assert(str == nil)
+assert(err == "cannot encode a value of type function")
+	`); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	L.PreloadModule("json", Loader)
+	if err := L.DoString(`
+local json = require("json")
+
+local v = json.decode('{"instances": [{"id": "i-1", "port": 22, "public": null, "tags": {"Name": "web"}}]}')
+assert(#v.instances == 1)
+assert(v.instances[1].id == "i-1")
+assert(v.instances[1].port == 22)
+assert(v.instances[1].public == nil)
+assert(v.instances[1].tags.Name == "web")
+
+assert(json.decode('null') == nil)
+
+-- null in an array is kept as json.null
+local a = json.decode('[1,null,3]')
+assert(#a == 3)
+assert(a[2] == json.null)
+assert(json.encode(a) == '[1,null,3]')
+assert(json.encode(json.decode('{"a":[null],"b":null}')) == '{"a":[null]}')
+
+local v, err = json.decode('{')
+assert(v == nil)
+assert(err ~= nil)
+	`); err != nil {
+		t.Error(err)
+	}
+}
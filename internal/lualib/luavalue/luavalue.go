@@ -0,0 +1,192 @@
+// Package luavalue converts values between Lua and Go for the built-in Lua modules.
+package luavalue
+
+import (
+	"fmt"
+	"github.com/yuin/gopher-lua"
+	"math"
+	"slices"
+	"time"
+)
+
+// Null is the value of the userdata that represents null like `json.null`,
+// because nil can not be stored in Lua tables.
+var Null = &struct{ name string }{"null"}
+
+// nullRegistryKey is the key of the registry to store the userdata that represents null.
+const nullRegistryKey = "xs.luavalue.null"
+
+// NewNull returns the userdata that represents null.
+// The same userdata is returned for the same state, so that it can be compared like `v == json.null`.
+func NewNull(L *lua.LState) *lua.LUserData {
+	if ud, ok := L.GetField(L.Get(lua.RegistryIndex), nullRegistryKey).(*lua.LUserData); ok {
+		return ud
+	}
+	ud := L.NewUserData()
+	ud.Value = Null
+	L.SetField(L.Get(lua.RegistryIndex), nullRegistryKey, ud)
+	return ud
+}
+
+// ToGoValue converts the Lua value into the Go value.
+// A table is converted into a slice if its keys are the sequence from 1 without holes, otherwise into a map whose keys
+// are converted into strings. An empty table is converted into an empty map. Numbers are converted into float64.
+func ToGoValue(lv lua.LValue) any {
+	switch v := lv.(type) {
+	case *lua.LNilType:
+		return nil
+	case lua.LBool:
+		return bool(v)
+	case lua.LString:
+		return string(v)
+	case lua.LNumber:
+		return float64(v)
+	case *lua.LUserData:
+		if v.Value == Null {
+			return nil
+		}
+		return v.Value
+	case *lua.LTable:
+		if isArray(v) {
+			maxn := v.MaxN()
+			ret := make([]any, 0, maxn)
+			for i := 1; i <= maxn; i++ {
+				ret = append(ret, ToGoValue(v.RawGetInt(i)))
+			}
+			return ret
+		}
+		ret := make(map[string]any)
+		v.ForEach(func(key, value lua.LValue) {
+			keystr := fmt.Sprint(ToGoValue(key))
+			ret[keystr] = ToGoValue(value)
+		})
+		return ret
+	default:
+		return v
+	}
+}
+
+// isArray reports whether the keys of the table are the sequence from 1 without holes.
+func isArray(tb *lua.LTable) bool {
+	maxn := tb.MaxN()
+	if maxn == 0 {
+		return false
+	}
+	n := 0
+	tb.ForEach(func(_, _ lua.LValue) {
+		n++
+	})
+	return n == maxn
+}
+
+// ToLuaValue converts the Go value decoded from JSON, YAML or TOML into the Lua value.
+// Null is converted into nil, so that the entry of a table is removed, except that null in an array is converted
+// into the userdata returned by NewNull to keep the array without holes.
+func ToLuaValue(L *lua.LState, v any) lua.LValue {
+	switch vv := v.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(vv)
+	case string:
+		return lua.LString(vv)
+	case int:
+		return lua.LNumber(vv)
+	case int64:
+		return lua.LNumber(vv)
+	case uint64:
+		return lua.LNumber(vv)
+	case float64:
+		return lua.LNumber(vv)
+	case time.Time:
+		return lua.LString(vv.Format(time.RFC3339))
+	case []any:
+		tb := L.CreateTable(len(vv), 0)
+		for i, item := range vv {
+			if item == nil {
+				tb.RawSetInt(i+1, NewNull(L))
+				continue
+			}
+			tb.RawSetInt(i+1, ToLuaValue(L, item))
+		}
+		return tb
+	case []map[string]any:
+		tb := L.CreateTable(len(vv), 0)
+		for i, item := range vv {
+			tb.RawSetInt(i+1, ToLuaValue(L, item))
+		}
+		return tb
+	case map[string]any:
+		tb := L.CreateTable(0, len(vv))
+		for k, item := range vv {
+			tb.RawSetString(k, ToLuaValue(L, item))
+		}
+		return tb
+	case map[any]any:
+		tb := L.CreateTable(0, len(vv))
+		for k, item := range vv {
+			tb.RawSetString(fmt.Sprint(k), ToLuaValue(L, item))
+		}
+		return tb
+	default:
+		return lua.LString(fmt.Sprint(v))
+	}
+}
+
+// ToEncodableValue converts the Lua value into the Go value to encode into JSON or YAML.
+// It is the same as ToGoValue except that integral numbers are converted into int64, so that they are not encoded
+// in the exponent notation like "1e+06", and that it returns an error for the values that can not be encoded like
+// functions and tables that contain themselves.
+func ToEncodableValue(lv lua.LValue) (any, error) {
+	return toEncodableValue(lv, nil)
+}
+
+func toEncodableValue(lv lua.LValue, parents []*lua.LTable) (any, error) {
+	switch v := lv.(type) {
+	case *lua.LNilType, lua.LBool, lua.LString:
+		return ToGoValue(v), nil
+	case lua.LNumber:
+		f := float64(v)
+		if f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+			return int64(f), nil
+		}
+		return f, nil
+	case *lua.LUserData:
+		if v.Value == Null {
+			return nil, nil
+		}
+	case *lua.LTable:
+		if slices.Contains(parents, v) {
+			return nil, fmt.Errorf("cannot encode a table that contains itself")
+		}
+		parents = append(parents, v)
+		if isArray(v) {
+			maxn := v.MaxN()
+			ret := make([]any, 0, maxn)
+			for i := 1; i <= maxn; i++ {
+				item, err := toEncodableValue(v.RawGetInt(i), parents)
+				if err != nil {
+					return nil, err
+				}
+				ret = append(ret, item)
+			}
+			return ret, nil
+		}
+		ret := make(map[string]any)
+		var err error
+		v.ForEach(func(key, value lua.LValue) {
+			if err != nil {
+				return
+			}
+			var item any
+			if item, err = toEncodableValue(value, parents); err == nil {
+				ret[fmt.Sprint(ToGoValue(key))] = item
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		return ret, nil
+	}
+	return nil, fmt.Errorf("cannot encode a value of type %s", lv.Type().String())
+}
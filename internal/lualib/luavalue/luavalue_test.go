@@ -0,0 +1,74 @@
+package luavalue
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yuin/gopher-lua"
+	"testing"
+)
+
+func TestToGoValue(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	L.SetGlobal("null", NewNull(L))
+
+	for _, tt := range []struct {
+		code     string
+		expected any
+	}{
+		{`return nil`, nil},
+		{`return null`, nil},
+		{`return true`, true},
+		{`return "a"`, "a"},
+		{`return 1.5`, 1.5},
+		{`return {}`, map[string]any{}},
+		{`return {"a", "b"}`, []any{"a", "b"}},
+		{`return {"a", null, "c"}`, []any{"a", nil, "c"}},
+		{`return {a = 1, b = {true}}`, map[string]any{"a": 1.0, "b": []any{true}}},
+		{`return {"a", b = "b"}`, map[string]any{"1": "a", "b": "b"}},
+		{`return {[1] = "a", [3] = "c"}`, map[string]any{"1": "a", "3": "c"}},
+	} {
+		require.NoError(t, L.DoString(tt.code), tt.code)
+		assert.Equal(t, tt.expected, ToGoValue(L.Get(-1)), tt.code)
+		L.Pop(1)
+	}
+}
+
+func TestToEncodableValue(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	require.NoError(t, L.DoString(`return {1, 1.5, 1e6, {n = 2}}`))
+	v, err := ToEncodableValue(L.Get(-1))
+	require.NoError(t, err)
+	assert.Equal(t, []any{int64(1), 1.5, int64(1000000), map[string]any{"n": int64(2)}}, v)
+
+	require.NoError(t, L.DoString(`local t = {}; t.self = t; return t`))
+	_, err = ToEncodableValue(L.Get(-1))
+	assert.EqualError(t, err, "cannot encode a table that contains itself")
+
+	require.NoError(t, L.DoString(`return {f = function() end}`))
+	_, err = ToEncodableValue(L.Get(-1))
+	assert.EqualError(t, err, "cannot encode a value of type function")
+}
+
+func TestToLuaValue(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	L.SetGlobal("null", NewNull(L))
+	L.SetGlobal("v", ToLuaValue(L, map[string]any{
+		"list":   []any{"a", 1, nil, true},
+		"map":    map[any]any{1: "one"},
+		"nested": map[string]any{"null": nil},
+	}))
+	require.NoError(t, L.DoString(`
+assert(#v.list == 4)
+assert(v.list[1] == "a")
+assert(v.list[2] == 1)
+assert(v.list[3] == null)
+assert(v.list[4] == true)
+assert(v.map["1"] == "one")
+assert(next(v.nested) == nil)
+`))
+}
@@ -0,0 +1,17 @@
+//go:build windows
+
+package shell
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup does nothing on Windows.
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+// signalProcess kills the process because Windows can not send signals to processes.
+func signalProcess(cmd *exec.Cmd, sig syscall.Signal) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,34 @@
+package shell
+
+import (
+	"strings"
+)
+
+// Quote quotes the string for the POSIX shell, so that the shell treats it as a single word as it is.
+// The string that consists of only safe characters is returned as it is.
+func Quote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if strings.IndexFunc(s, isUnsafeRune) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Join quotes the arguments and joins them with spaces into a command line for the POSIX shell.
+func Join(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, Quote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+func isUnsafeRune(r rune) bool {
+	switch {
+	case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		return false
+	}
+	return !strings.ContainsRune("@%+=:,./_-", r)
+}
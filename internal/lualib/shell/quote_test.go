@@ -0,0 +1,34 @@
+package shell
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os/exec"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	for _, tt := range []struct {
+		s        string
+		expected string
+	}{
+		{"", "''"},
+		{"abc", "abc"},
+		{"/path/to/file-1.txt", "/path/to/file-1.txt"},
+		{"user@host:22", "user@host:22"},
+		{"a b", "'a b'"},
+		{"it's", `'it'\''s'`},
+		{"$HOME", "'$HOME'"},
+		{"a\nb", "'a\nb'"},
+		{"*", "'*'"},
+	} {
+		assert.Equal(t, tt.expected, Quote(tt.s), tt.s)
+	}
+}
+
+func TestJoin(t *testing.T) {
+	args := []string{"printf", "%s|", "a b", "it's", `"double"`, "$(echo x)", "", "back\\slash", "new\nline"}
+	out, err := exec.Command("sh", "-c", Join(args)).Output()
+	require.NoError(t, err)
+	assert.Equal(t, "a b|it's|\"double\"|$(echo x)||back\\slash|new\nline|", string(out))
+}
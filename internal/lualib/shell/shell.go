@@ -2,23 +2,60 @@ package shell
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"github.com/Songmu/wrapcommander"
 	"github.com/yuin/gopher-lua"
+	"golang.org/x/term"
 	"io"
 	"os"
 	"os/exec"
 	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
+// Tracker is notified when a command is run.
+// It is used to expire the cache of the evaluated config, because the output of a command can change at any time.
+type Tracker interface {
+	// SetTTL sets the time to live of the hosts. Zero means that they must not be cached.
+	SetTTL(ttl time.Duration)
+}
+
 func Loader(L *lua.LState) int {
-	registerLuaCommandResultType(L)
+	return LoaderWithTracker(nil)(L)
+}
 
-	tb := L.NewTable()
-	L.SetFuncs(tb, map[string]lua.LGFunction{
-		"run": run,
-	})
-	L.Push(tb)
-	return 1
+// LoaderWithTracker returns the loader of the module that disables the cache by the tracker when a command is run.
+// The tracker can be nil.
+func LoaderWithTracker(tracker Tracker) lua.LGFunction {
+	track := func(fn lua.LGFunction) lua.LGFunction {
+		if tracker == nil {
+			return fn
+		}
+		return func(L *lua.LState) int {
+			tracker.SetTTL(0)
+			return fn(L)
+		}
+	}
+
+	return func(L *lua.LState) int {
+		registerLuaCommandResultType(L)
+		registerLuaProcessType(L)
+
+		tb := L.NewTable()
+		L.SetFuncs(tb, map[string]lua.LGFunction{
+			"run":   track(run),
+			"exec":  track(execArgv),
+			"spawn": track(spawn),
+			"quote": quote,
+			"join":  join,
+		})
+		L.Push(tb)
+		return 1
+	}
 }
 
 type CommandResult struct {
@@ -27,6 +64,7 @@ type CommandResult struct {
 	CombinedOutput bytes.Buffer
 	ExitStatus     int
 	Err            error
+	TimedOut       bool
 }
 
 func (r *CommandResult) Success() bool {
@@ -37,44 +75,260 @@ func (r *CommandResult) Failure() bool {
 	return r.ExitStatus != 0
 }
 
+// CommandOptions are the options of shell.run and shell.spawn.
+type CommandOptions struct {
+	// Env is the environment variables added to the environment of xs.
+	Env map[string]string
+	// Dir is the working directory. The empty string means the current directory.
+	Dir string
+	// Stdin is the input of the command. If it is nil, shell.run passes the stdin of xs and shell.spawn passes nothing.
+	Stdin *string
+	// Timeout kills the command when it is exceeded. Zero means no timeout.
+	Timeout time.Duration
+	// Stream outputs stdout and stderr to the stdout and stderr of xs while the command is running,
+	// in addition to capturing them.
+	Stream bool
+}
+
+// checkCommandOptions returns the options table at n like `{ env = { FOO = "bar" }, dir = "/tmp", timeout = 10 }`.
+func checkCommandOptions(L *lua.LState, n int) *CommandOptions {
+	opts := &CommandOptions{}
+	tb := L.OptTable(n, nil)
+	if tb == nil {
+		return opts
+	}
+
+	if env, ok := tb.RawGetString("env").(*lua.LTable); ok {
+		opts.Env = map[string]string{}
+		env.ForEach(func(k, v lua.LValue) {
+			opts.Env[lua.LVAsString(k)] = lua.LVAsString(v)
+		})
+	}
+	if dir, ok := tb.RawGetString("dir").(lua.LString); ok {
+		opts.Dir = string(dir)
+	}
+	if stdin, ok := tb.RawGetString("stdin").(lua.LString); ok {
+		s := string(stdin)
+		opts.Stdin = &s
+	}
+	if timeout, ok := tb.RawGetString("timeout").(lua.LNumber); ok {
+		opts.Timeout = time.Duration(float64(timeout) * float64(time.Second))
+	}
+	opts.Stream = lua.LVAsBool(tb.RawGetString("stream"))
+	return opts
+}
+
+// run runs the command and waits for it like `shell.run("echo hello", { timeout = 10 })`.
 func run(L *lua.LState) int {
 	command := L.CheckString(1)
-	result := runCommand(command)
+	opts := checkCommandOptions(L, 2)
+	result := runCommand(command, opts)
 	L.Push(newLuaCommandResult(L, result))
 	return 1
 }
 
-func runCommand(command string) *CommandResult {
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.Command("cmd", "/c", command)
+// execArgv runs the command without the shell like `shell.exec({"ls", "-l", dir})`.
+// It takes the same options as shell.run.
+func execArgv(L *lua.LState) int {
+	argv := checkArgv(L, 1)
+	opts := checkCommandOptions(L, 2)
+	result := runArgv(argv, opts)
+	L.Push(newLuaCommandResult(L, result))
+	return 1
+}
+
+// spawn starts the command in the background like `shell.spawn("ssh -N -L 8080:localhost:80 web")`.
+// The command can also be an argv list that is run without the shell like `shell.spawn({"ssh", "-N", "web"})`.
+// It returns the handle of the process, or nil and the error message if the command fails to start.
+func spawn(L *lua.LState) int {
+	var argv []string
+	if L.Get(1).Type() == lua.LTTable {
+		argv = checkArgv(L, 1)
 	} else {
-		cmd = exec.Command("sh", "-c", command)
+		argv = shellArgv(L.CheckString(1))
 	}
+	opts := checkCommandOptions(L, 2)
+	p, err := startProcess(argv, opts, false)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(newLuaProcess(L, p))
+	return 1
+}
 
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	var combinedOutput bytes.Buffer
+// quote quotes the string for the POSIX shell like `shell.quote("it's")`.
+func quote(L *lua.LState) int {
+	L.Push(lua.LString(Quote(L.CheckString(1))))
+	return 1
+}
 
-	cmd.Stdout = io.MultiWriter(&stdout, &combinedOutput)
-	cmd.Stderr = io.MultiWriter(&stderr, &combinedOutput)
-	cmd.Stdin = os.Stdin
+// join quotes the strings and joins them with spaces like `shell.join({"echo", "a b"})`.
+func join(L *lua.LState) int {
+	L.Push(lua.LString(Join(checkArgv(L, 1))))
+	return 1
+}
 
-	var exitStatus int
-	err := cmd.Run()
+// checkArgv returns the array table of strings at n. It raises an error if the table is empty or has non-strings.
+func checkArgv(L *lua.LState, n int) []string {
+	argv, err := ToArgv(L.CheckTable(n))
 	if err != nil {
-		exitStatus = wrapcommander.ResolveExitCode(err)
-	} else {
-		exitStatus = 0
+		L.ArgError(n, err.Error())
+	}
+	return argv
+}
+
+// ToArgv converts the array table of strings into the argv. Numbers are converted into strings.
+func ToArgv(tb *lua.LTable) ([]string, error) {
+	n := tb.MaxN()
+	if n == 0 {
+		return nil, fmt.Errorf("argv must not be empty")
+	}
+	argv := make([]string, 0, n)
+	for i := 1; i <= n; i++ {
+		switch v := tb.RawGetInt(i).(type) {
+		case lua.LString, lua.LNumber:
+			argv = append(argv, lua.LVAsString(v))
+		default:
+			return nil, fmt.Errorf("argv must be an array of strings but #%d is %s", i, v.Type().String())
+		}
+	}
+	return argv, nil
+}
+
+func shellArgv(command string) []string {
+	if runtime.GOOS == "windows" {
+		return []string{"cmd", "/c", command}
+	}
+	return []string{"sh", "-c", command}
+}
+
+func runCommand(command string, opts *CommandOptions) *CommandResult {
+	return runArgv(shellArgv(command), opts)
+}
+
+func runArgv(argv []string, opts *CommandOptions) *CommandResult {
+	p, err := startProcess(argv, opts, true)
+	if err != nil {
+		return &CommandResult{
+			Err:        err,
+			ExitStatus: wrapcommander.ResolveExitCode(err),
+		}
+	}
+	return p.Wait()
+}
+
+// Process is a command started by shell.spawn or shell.run.
+type Process struct {
+	cmd    *exec.Cmd
+	result *CommandResult
+	done   chan struct{}
+}
+
+// startProcess starts the command in a new process group, so that killing it also kills its child processes.
+// The command that reads the terminal runs in the process group of xs because it can not read the terminal from
+// a background process group.
+func startProcess(argv []string, opts *CommandOptions, inheritStdin bool) (*Process, error) {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
 	}
 
-	return &CommandResult{
-		Stdout:         stdout,
-		Stderr:         stderr,
-		CombinedOutput: combinedOutput,
-		Err:            err,
-		ExitStatus:     exitStatus,
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = opts.Dir
+	if len(opts.Env) > 0 {
+		cmd.Env = os.Environ()
+		for k, v := range opts.Env {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
 	}
+
+	result := &CommandResult{}
+	stdout := io.Writer(&result.Stdout)
+	stderr := io.Writer(&result.Stderr)
+	if opts.Stream {
+		stdout = io.MultiWriter(stdout, os.Stdout)
+		stderr = io.MultiWriter(stderr, os.Stderr)
+	}
+	combined := &lockedWriter{w: &result.CombinedOutput}
+	cmd.Stdout = io.MultiWriter(stdout, combined)
+	cmd.Stderr = io.MultiWriter(stderr, combined)
+
+	switch {
+	case opts.Stdin != nil:
+		cmd.Stdin = strings.NewReader(*opts.Stdin)
+	case inheritStdin:
+		cmd.Stdin = os.Stdin
+	}
+	if cmd.Stdin != os.Stdin || !term.IsTerminal(int(os.Stdin.Fd())) {
+		setProcessGroup(cmd)
+	}
+	cmd.Cancel = func() error {
+		return signalProcess(cmd, syscall.SIGKILL)
+	}
+	if opts.Timeout > 0 {
+		// The child processes that keep the output open must not block waiting for the command after it is killed.
+		cmd.WaitDelay = time.Second
+	}
+
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	p := &Process{cmd: cmd, result: result, done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		defer cancel()
+		err := cmd.Wait()
+		result.Err = err
+		if err != nil {
+			result.ExitStatus = wrapcommander.ResolveExitCode(err)
+		}
+		result.TimedOut = ctx.Err() == context.DeadlineExceeded
+	}()
+	return p, nil
+}
+
+// Pid returns the process ID.
+func (p *Process) Pid() int {
+	return p.cmd.Process.Pid
+}
+
+// Wait waits for the process to exit and returns the result. It can be called multiple times.
+func (p *Process) Wait() *CommandResult {
+	<-p.done
+	return p.result
+}
+
+// Signal sends the signal to the process and its child processes. It returns an error if the process has exited.
+func (p *Process) Signal(sig syscall.Signal) error {
+	select {
+	case <-p.done:
+		return fmt.Errorf("process %d has already exited", p.Pid())
+	default:
+	}
+	return signalProcess(p.cmd, sig)
+}
+
+// lockedWriter serializes the writes from the goroutines that copy stdout and stderr.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(b)
+}
+
+var signals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"KILL": syscall.SIGKILL,
+	"TERM": syscall.SIGTERM,
 }
 
 const luaCommandResultTypeName = "CommandResult*"
@@ -88,6 +342,7 @@ func registerLuaCommandResultType(L *lua.LState) {
 		"stdout":          commandResultStdout,
 		"stderr":          commandResultStderr,
 		"combined_output": commandResultCombinedOutput,
+		"timed_out":       commandResultTimedOut,
 	}))
 }
 
@@ -136,3 +391,65 @@ func commandResultCombinedOutput(L *lua.LState) int {
 	L.Push(lua.LString(checkCommandResult(L).CombinedOutput.String()))
 	return 1
 }
+
+func commandResultTimedOut(L *lua.LState) int {
+	L.Push(lua.LBool(checkCommandResult(L).TimedOut))
+	return 1
+}
+
+const luaProcessTypeName = "Process*"
+
+func registerLuaProcessType(L *lua.LState) {
+	mt := L.NewTypeMetatable(luaProcessTypeName)
+	L.SetField(mt, "__index", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"pid":  processPid,
+		"wait": processWait,
+		"kill": processKill,
+	}))
+}
+
+func newLuaProcess(L *lua.LState, p *Process) *lua.LUserData {
+	ud := L.NewUserData()
+	ud.Value = p
+	L.SetMetatable(ud, L.GetTypeMetatable(luaProcessTypeName))
+	return ud
+}
+
+func checkProcess(L *lua.LState) *Process {
+	ud := L.CheckUserData(1)
+	if p, ok := ud.Value.(*Process); ok {
+		return p
+	}
+	L.ArgError(1, "Process expected")
+	return nil
+}
+
+func processPid(L *lua.LState) int {
+	L.Push(lua.LNumber(checkProcess(L).Pid()))
+	return 1
+}
+
+// processWait waits for the process to exit and returns the CommandResult like `p:wait()`.
+func processWait(L *lua.LState) int {
+	L.Push(newLuaCommandResult(L, checkProcess(L).Wait()))
+	return 1
+}
+
+// processKill sends the signal to the process like `p:kill()` or `p:kill("INT")`. The default signal is "TERM".
+// It returns true, or nil and the error message.
+func processKill(L *lua.LState) int {
+	p := checkProcess(L)
+	name := strings.TrimPrefix(strings.ToUpper(L.OptString(2, "TERM")), "SIG")
+	sig, ok := signals[name]
+	if !ok {
+		L.ArgError(2, "unsupported signal: "+name)
+		return 0
+	}
+	if err := p.Signal(sig); err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(lua.LTrue)
+	return 1
+}
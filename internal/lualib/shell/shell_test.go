@@ -4,6 +4,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/yuin/gopher-lua"
 	"testing"
+	"time"
 )
 
 func TestRun(t *testing.T) {
@@ -47,3 +48,117 @@ assert(result:combined_output() ~= "")
 		assert.NoError(t, err)
 	})
 }
+
+func TestRunWithOptions(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	L.PreloadModule("shell", Loader)
+	L.SetGlobal("dir", lua.LString(t.TempDir()))
+
+	err := L.DoString(`
+local shell = require("shell")
+
+local result = shell.run("echo $FOO; pwd", { env = { FOO = "bar" }, dir = dir })
+assert(result:stdout() == "bar\n" .. dir .. "\n", result:stdout())
+
+result = shell.run("cat", { stdin = "hello" })
+assert(result:stdout() == "hello")
+
+result = shell.run("sleep 10", { timeout = 0.1 })
+assert(result:failure())
+assert(result:timed_out())
+
+result = shell.run("echo hello", { timeout = 10, stream = false })
+assert(result:success())
+assert(not result:timed_out())
+`)
+	assert.NoError(t, err)
+}
+
+func TestSpawn(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	L.PreloadModule("shell", Loader)
+
+	err := L.DoString(`
+local shell = require("shell")
+
+local p = assert(shell.spawn("sleep 10"))
+assert(p:pid() > 0)
+assert(p:kill() == true)
+local result = p:wait()
+assert(result:failure())
+
+local ok, err = p:kill()
+assert(ok == nil)
+assert(err:find("already exited"))
+
+p = assert(shell.spawn("echo out; exit 3"))
+assert(p:wait():exit_status() == 3)
+assert(p:wait():stdout() == "out\n")
+
+p, err = shell.spawn("true", { dir = "/nonexistent" })
+assert(p == nil)
+assert(err ~= nil)
+`)
+	assert.NoError(t, err)
+}
+
+func TestExec(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	L.PreloadModule("shell", Loader)
+
+	err := L.DoString(`
+local shell = require("shell")
+
+local result = shell.exec({"printf", "%s|", "a b", "it's", "$HOME", 1})
+assert(result:success())
+assert(result:stdout() == "a b|it's|$HOME|1|", result:stdout())
+
+result = shell.exec({"unknown-command-for-test"})
+assert(result:failure())
+
+assert(shell.quote("it's") == "'it'\\''s'")
+assert(shell.join({"echo", "a b", "c"}) == "echo 'a b' c")
+
+local ok, err = pcall(shell.exec, {})
+assert(not ok)
+ok, err = pcall(shell.join, {"echo", {}})
+assert(not ok)
+
+local p = assert(shell.spawn({"sh", "-c", "echo $0", "a b"}))
+assert(p:wait():stdout() == "a b\n")
+`)
+	assert.NoError(t, err)
+}
+
+type testTracker struct {
+	ttls []time.Duration
+}
+
+func (t *testTracker) SetTTL(ttl time.Duration) {
+	t.ttls = append(t.ttls, ttl)
+}
+
+func TestLoaderWithTracker(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+	tracker := &testTracker{}
+	L.PreloadModule("shell", LoaderWithTracker(tracker))
+
+	assert.NoError(t, L.DoString(`
+local shell = require("shell")
+assert(shell.quote("a b") == "'a b'")
+assert(shell.join({"echo", "a"}) == "echo a")
+`))
+	assert.Empty(t, tracker.ttls)
+
+	assert.NoError(t, L.DoString(`
+local shell = require("shell")
+assert(shell.run("true"):success())
+assert(shell.exec({"true"}):success())
+assert(shell.spawn({"true"}):wait():success())
+`))
+	assert.Equal(t, []time.Duration{0, 0, 0}, tracker.ttls)
+}
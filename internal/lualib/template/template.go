@@ -2,7 +2,7 @@ package template
 
 import (
 	"bytes"
-	"fmt"
+	"github.com/kohkimakimoto/xs/internal/lualib/luavalue"
 	"github.com/yuin/gopher-lua"
 	"text/template"
 )
@@ -30,7 +30,7 @@ func doString(L *lua.LState) int {
 	}
 
 	if L.GetTop() >= 2 {
-		dict = toGoValue(L.CheckTable(2))
+		dict = luavalue.ToGoValue(L.CheckTable(2))
 	}
 
 	var b bytes.Buffer
@@ -57,7 +57,7 @@ func doFile(L *lua.LState) int {
 	}
 
 	if L.GetTop() >= 2 {
-		dict = toGoValue(L.CheckTable(2))
+		dict = luavalue.ToGoValue(L.CheckTable(2))
 	}
 
 	var b bytes.Buffer
@@ -71,34 +71,3 @@ func doFile(L *lua.LState) int {
 	L.Push(lua.LString(s))
 	return 1
 }
-
-func toGoValue(lv lua.LValue) any {
-	switch v := lv.(type) {
-	case *lua.LNilType:
-		return nil
-	case lua.LBool:
-		return bool(v)
-	case lua.LString:
-		return string(v)
-	case lua.LNumber:
-		return float64(v)
-	case *lua.LTable:
-		maxn := v.MaxN()
-		if maxn == 0 { // table
-			ret := make(map[string]any)
-			v.ForEach(func(key, value lua.LValue) {
-				keystr := fmt.Sprint(toGoValue(key))
-				ret[keystr] = toGoValue(value)
-			})
-			return ret
-		} else { // array
-			ret := make([]any, 0, maxn)
-			for i := 1; i <= maxn; i++ {
-				ret = append(ret, toGoValue(v.RawGetInt(i)))
-			}
-			return ret
-		}
-	default:
-		return v
-	}
-}
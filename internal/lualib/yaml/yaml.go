@@ -0,0 +1,57 @@
+package yaml
+
+import (
+	"github.com/kohkimakimoto/xs/internal/lualib/luavalue"
+	"github.com/yuin/gopher-lua"
+	"gopkg.in/yaml.v3"
+)
+
+func Loader(L *lua.LState) int {
+	tb := L.NewTable()
+	L.SetFuncs(tb, map[string]lua.LGFunction{
+		"encode": encode,
+		"decode": decode,
+	})
+	tb.RawSetString("null", luavalue.NewNull(L))
+	L.Push(tb)
+	return 1
+}
+
+// encode encodes the value into YAML like `yaml.encode(value)`.
+// A table is encoded into a sequence if its keys are the sequence from 1, otherwise into a mapping.
+func encode(L *lua.LState) int {
+	v, err := luavalue.ToEncodableValue(L.CheckAny(1))
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	L.Push(lua.LString(b))
+	return 1
+}
+
+// decode decodes the YAML string into the value like `yaml.decode(str)`.
+// null is decoded into nil, so the entries whose values are null are removed from the tables,
+// except that null in an array is decoded into the null value to keep the array without holes.
+// Timestamps are decoded into the strings in RFC 3339.
+func decode(L *lua.LState) int {
+	str := L.CheckString(1)
+
+	var v any
+	if err := yaml.Unmarshal([]byte(str), &v); err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+
+	L.Push(luavalue.ToLuaValue(L, v))
+	return 1
+}
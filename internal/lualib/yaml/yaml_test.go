@@ -0,0 +1,71 @@
+package yaml
+
+import (
+	"github.com/yuin/gopher-lua"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	L.PreloadModule("yaml", Loader)
+	if err := L.DoString(`
+local yaml = require("yaml")
+
+assert(yaml.encode({name = "web", ports = {22, 80}, ratio = 0.5, extra = yaml.null}) == [[
+extra: null
+name: web
+ports:
+    - 22
+    - 80
+ratio: 0.5
+]])
+assert(yaml.encode(1e6) == "1000000\n")
+
+local str, err = yaml.encode(print)
+assert(str == nil)
+assert(err == "cannot encode a value of type function")
+	`); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	L.PreloadModule("yaml", Loader)
+	if err := L.DoString(`
+local yaml = require("yaml")
+
+local v = yaml.decode([[
+hosts:
+  - name: web
+    port: 22
+    hidden: false
+    description: ~
+    created: 2025-01-02T03:04:05Z
+  - 1: one
+]])
+assert(#v.hosts == 2)
+assert(v.hosts[1].name == "web")
+assert(v.hosts[1].port == 22)
+assert(v.hosts[1].hidden == false)
+assert(v.hosts[1].description == nil)
+assert(v.hosts[1].created == "2025-01-02T03:04:05Z")
+assert(v.hosts[2]["1"] == "one")
+
+-- null in an array is kept as yaml.null
+local a = yaml.decode("[1, null, 3]")
+assert(#a == 3)
+assert(a[2] == yaml.null)
+assert(yaml.encode(a) == "- 1\n- null\n- 3\n")
+
+local v, err = yaml.decode("a: [")
+assert(v == nil)
+assert(err ~= nil)
+	`); err != nil {
+		t.Error(err)
+	}
+}
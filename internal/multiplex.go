@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/yuin/gopher-lua"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Multiplex is the settings of the connection multiplexing enabled by `xs.multiplex = true`.
+// It makes the generated ssh_config share a connection to a host among the ssh processes by ControlMaster.
+type Multiplex struct {
+	// Persist is the value of ControlPersist.
+	Persist string
+}
+
+const defaultControlPersist = "10m"
+
+// multiplexKeywords is the ssh_config keywords that xs.multiplex injects into the hosts.
+var multiplexKeywords = []string{"ControlMaster", "ControlPath", "ControlPersist"}
+
+// parseMultiplex parses the xs.multiplex setting. It returns nil if the multiplexing is disabled.
+// The setting is a boolean or a table like `{ persist = "30m" }`. A number of persist is seconds.
+func parseMultiplex(value lua.LValue) (*Multiplex, error) {
+	switch v := value.(type) {
+	case *lua.LNilType:
+		return nil, nil
+	case lua.LBool:
+		if !v {
+			return nil, nil
+		}
+		return &Multiplex{Persist: defaultControlPersist}, nil
+	case *lua.LTable:
+		m := &Multiplex{Persist: defaultControlPersist}
+		switch persist := v.RawGetString("persist").(type) {
+		case *lua.LNilType:
+		case lua.LNumber:
+			m.Persist = fmt.Sprintf("%d", int64(persist))
+		case lua.LString:
+			m.Persist = string(persist)
+		default:
+			return nil, fmt.Errorf("xs.multiplex.persist must be a number or a string but got %s", persist.Type().String())
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("xs.multiplex must be a boolean or a table but got %s", value.Type().String())
+	}
+}
+
+// controlPath returns the ControlPath in the multiplex directory. "%C" is a short hash of the connection,
+// so that the path does not exceed the limit of the length of a unix domain socket.
+func (m *Multiplex) controlPath() string {
+	path := filepath.Join(getMultiplexDir(), "%C")
+	if strings.ContainsAny(path, " \t") {
+		path = `"` + path + `"`
+	}
+	return path
+}
+
+// multiplexHosts returns the hosts with the multiplex keywords injected for the generated ssh_config.
+// The keywords are injected into the concrete hosts defined in Lua, unless the host or a pattern host that applies
+// to it defines the keyword, so that the hosts can opt out like `ControlMaster = "no"`.
+// The hosts are copied, and the hosts of the config are not modified.
+func (m *Multiplex) multiplexHosts(cfg *Config, hosts []*Host) []*Host {
+	values := map[string]string{
+		"ControlMaster":  "auto",
+		"ControlPath":    m.controlPath(),
+		"ControlPersist": m.Persist,
+	}
+
+	ret := make([]*Host, 0, len(hosts))
+	for _, h := range hosts {
+		if h.IsPattern() || h.ImportedFrom != "" {
+			ret = append(ret, h)
+			continue
+		}
+		copied := *h
+		copied.SSHConfig = make(map[string]string, len(h.SSHConfig)+len(multiplexKeywords))
+		for k, v := range h.SSHConfig {
+			copied.SSHConfig[k] = v
+		}
+		for _, keyword := range multiplexKeywords {
+			if !cfg.definesSSHConfig(h, keyword) {
+				copied.SSHConfig[keyword] = values[keyword]
+			}
+		}
+		ret = append(ret, &copied)
+	}
+	return ret
+}
+
+// definesSSHConfig reports whether the concrete host or a pattern host that applies to it defines the keyword.
+func (cfg *Config) definesSSHConfig(h *Host, keyword string) bool {
+	if h.sshConfigValue(keyword) != "" {
+		return true
+	}
+	for _, p := range cfg.Hosts {
+		if p.IsPattern() && p.MatchesHostname(h.Name) && p.sshConfigValue(keyword) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareMultiplexDir creates the directory of the control sockets. It must not be accessible by other users.
+func prepareMultiplexDir() error {
+	dir := getMultiplexDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return os.Chmod(dir, 0700)
+}
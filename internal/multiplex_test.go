@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"github.com/kohkimakimoto/xs/internal/debuglogger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yuin/gopher-lua"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseMultiplex(t *testing.T) {
+	L := lua.NewState()
+	defer L.Close()
+
+	for _, tt := range []struct {
+		code     string
+		expected *Multiplex
+	}{
+		{`return nil`, nil},
+		{`return false`, nil},
+		{`return true`, &Multiplex{Persist: "10m"}},
+		{`return {}`, &Multiplex{Persist: "10m"}},
+		{`return { persist = "1h" }`, &Multiplex{Persist: "1h"}},
+		{`return { persist = 60 }`, &Multiplex{Persist: "60"}},
+	} {
+		require.NoError(t, L.DoString(tt.code))
+		m, err := parseMultiplex(L.Get(-1))
+		L.Pop(1)
+		require.NoError(t, err, tt.code)
+		assert.Equal(t, tt.expected, m, tt.code)
+	}
+
+	_, err := parseMultiplex(lua.LString("yes"))
+	assert.EqualError(t, err, "xs.multiplex must be a boolean or a table but got string")
+}
+
+func TestGenSSHConfig_Multiplex(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.lua")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+xs.multiplex = { persist = "30m" }
+
+host "web1" {
+  ssh_config = { HostName = "192.168.0.11" },
+}
+
+host "web2" {
+  ssh_config = { controlmaster = "no" },
+}
+
+host "db1.internal" {}
+
+host "*.internal" {
+  ssh_config = { ControlPersist = "no" },
+}
+`), 0644))
+
+	cfg, L, err := loadConfig([]string{configFile}, debuglogger.New(io.Discard, false, true))
+	require.NoError(t, err)
+	defer L.Close()
+
+	b, err := genSSHConfig(cfg)
+	require.NoError(t, err)
+	controlPath := filepath.Join(home, ".xs", "mux", "%C")
+	assert.Equal(t, `# The configuration is generated by xs with the config file: `+configFile+`
+
+Host web1
+    ControlMaster auto
+    ControlPath `+controlPath+`
+    ControlPersist 30m
+    HostName 192.168.0.11
+
+Host web2
+    ControlPath `+controlPath+`
+    ControlPersist 30m
+    controlmaster no
+
+Host db1.internal
+    ControlMaster auto
+    ControlPath `+controlPath+`
+
+Host *.internal
+    ControlPersist no
+
+`, string(b))
+
+	info, err := os.Stat(filepath.Join(home, ".xs", "mux"))
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	// the hosts of the config are not modified
+	assert.Equal(t, map[string]string{"HostName": "192.168.0.11"}, cfg.NewHostFilter().GetHostByName("web1").SSHConfig)
+}
@@ -0,0 +1,210 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kohkimakimoto/xs/internal/debuglogger"
+	"github.com/kohkimakimoto/xs/internal/sshclient"
+	"github.com/urfave/cli/v3"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+	"os"
+	"os/user"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nativeSSHConfigKeys is the list of ssh_config parameters that the native ssh client understands.
+var nativeSSHConfigKeys = []string{
+	"hostname",
+	"port",
+	"user",
+	"identityfile",
+	"proxyjump",
+	"forwardagent",
+	"stricthostkeychecking",
+	"userknownhostsfile",
+	"connecttimeout",
+}
+
+// runNativeSSH connects to the destination by the built-in ssh client instead of the ssh command.
+// It supports only a subset of ssh options and ssh_config parameters.
+func runNativeSSH(cmd *cli.Command, cfg *Config, options []string, params []string) error {
+	logger := debuglogger.Get(cmd)
+
+	overrides := map[string]string{}
+	tty := ""
+	for i := 0; i < len(options); i++ {
+		opt := options[i]
+		value := ""
+		if i+1 < len(options) {
+			value = options[i+1]
+		}
+		switch opt {
+		case "-p":
+			overrides["port"] = value
+			i++
+		case "-l":
+			overrides["user"] = value
+			i++
+		case "-i":
+			// like ssh, multiple identity files are tried in order
+			if prev, ok := overrides["identityfile"]; ok {
+				value = prev + "\n" + value
+			}
+			overrides["identityfile"] = value
+			i++
+		case "-J":
+			overrides["proxyjump"] = value
+			i++
+		case "-o":
+			k, v, ok := strings.Cut(value, "=")
+			if !ok {
+				k, v, _ = strings.Cut(value, " ")
+			}
+			overrides[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+			i++
+		case "-A":
+			overrides["forwardagent"] = "yes"
+		case "-a":
+			overrides["forwardagent"] = "no"
+		case "-t", "-T":
+			tty = opt
+		default:
+			return fmt.Errorf("%s option is not supported by the native ssh client", opt)
+		}
+	}
+
+	clientConfig, err := newNativeSSHClientConfig(cfg, params[0], overrides, logger, []string{})
+	if err != nil {
+		return err
+	}
+
+	command := strings.Join(params[1:], " ")
+	opts := &sshclient.RunOptions{
+		Command: command,
+		TTY:     tty == "-t" || (tty == "" && command == "" && term.IsTerminal(int(os.Stdin.Fd()))),
+		Stdin:   os.Stdin,
+		Stdout:  os.Stdout,
+		Stderr:  os.Stderr,
+	}
+
+	logger.Printf("connect by the native ssh client: %s@%s", clientConfig.User, clientConfig.Addr())
+
+	client, err := sshclient.Dial(clientConfig)
+	if err != nil {
+		return cli.Exit(err, 255)
+	}
+	defer func() { _ = client.Close() }()
+
+	if err := sshclient.Run(client, clientConfig, opts); err != nil {
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			return cli.Exit("", exitErr.ExitStatus())
+		}
+		return cli.Exit(err, 255)
+	}
+	return nil
+}
+
+// newNativeSSHClientConfig resolves the connection settings of the destination from the config.
+// The overrides take precedence over ssh_config parameters like options of the ssh command.
+// The jumps holds the destinations being resolved to detect circular ProxyJump.
+func newNativeSSHClientConfig(cfg *Config, destination string, overrides map[string]string, logger *debuglogger.Logger, jumps []string) (*sshclient.Config, error) {
+	destUser, hostname, destPort := parseDestination(destination)
+
+	values := effectiveSSHConfig(cfg, hostname)
+	for k, v := range overrides {
+		if prev, ok := values[k]; ok && isCumulativeSSHConfigKeyword(k) {
+			// the values of the options are tried before the ones of ssh_config
+			v = v + "\n" + prev
+		}
+		values[k] = v
+	}
+	for k := range values {
+		if !slices.Contains(nativeSSHConfigKeys, k) {
+			logger.Printf("ssh_config parameter is ignored by the native ssh client: %s", k)
+		}
+	}
+
+	c := &sshclient.Config{
+		HostName:              hostname,
+		Port:                  "22",
+		StrictHostKeyChecking: values["stricthostkeychecking"],
+		ForwardAgent:          strings.EqualFold(values["forwardagent"], "yes"),
+	}
+	if v := values["hostname"]; v != "" {
+		c.HostName = strings.ReplaceAll(v, "%h", hostname)
+	}
+	if v := values["port"]; v != "" {
+		c.Port = v
+	}
+	if destPort != "" {
+		c.Port = destPort
+	}
+	c.User = values["user"]
+	if destUser != "" {
+		c.User = destUser
+	}
+	if c.User == "" {
+		if u, err := user.Current(); err == nil {
+			c.User = u.Username
+		}
+	}
+	if v := values["identityfile"]; v != "" {
+		c.IdentityFiles = strings.Split(v, "\n")
+	}
+	if v := values["userknownhostsfile"]; v != "" {
+		c.UserKnownHostsFiles = strings.Fields(v)
+	}
+	if v := values["connecttimeout"]; v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ConnectTimeout: %s", v)
+		}
+		c.ConnectTimeout = time.Duration(seconds) * time.Second
+	}
+
+	if v := values["proxyjump"]; v != "" && !strings.EqualFold(v, "none") {
+		for _, jump := range strings.Split(v, ",") {
+			jump = strings.TrimSpace(jump)
+			if slices.Contains(jumps, jump) {
+				return nil, fmt.Errorf("circular ProxyJump: %s", jump)
+			}
+			jc, err := newNativeSSHClientConfig(cfg, jump, map[string]string{}, logger, append(jumps, jump))
+			if err != nil {
+				return nil, err
+			}
+			// flatten the jump hosts of the jump host
+			c.ProxyJump = append(c.ProxyJump, jc.ProxyJump...)
+			jc.ProxyJump = nil
+			c.ProxyJump = append(c.ProxyJump, jc)
+		}
+	}
+	return c, nil
+}
+
+// effectiveSSHConfig returns the ssh_config parameters that apply to the hostname, keyed by lowercase names.
+// Like ssh, the first obtained value for each parameter is used, except that the values of the cumulative keywords
+// like IdentityFile are accumulated and joined with "\n".
+func effectiveSSHConfig(cfg *Config, hostname string) map[string]string {
+	values := map[string]string{}
+	for _, h := range sortHostsForSSHConfig(cfg.Hosts) {
+		if !h.MatchesHostname(hostname) {
+			continue
+		}
+		for _, param := range h.SortedSSHConfig() {
+			for k, v := range param {
+				k = strings.ToLower(k)
+				if prev, ok := values[k]; !ok {
+					values[k] = v
+				} else if isCumulativeSSHConfigKeyword(k) {
+					values[k] = prev + "\n" + v
+				}
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"github.com/kohkimakimoto/xs/internal/debuglogger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestNewNativeSSHClientConfig(t *testing.T) {
+	cfg := &Config{
+		Hosts: []*Host{
+			{
+				Name: "web1",
+				SSHConfig: map[string]string{
+					"HostName":     "10.0.0.1",
+					"User":         "web-user",
+					"IdentityFile": "~/.ssh/id_web",
+					"ProxyJump":    "bastion2",
+				},
+			},
+			{
+				Name: "bastion2",
+				SSHConfig: map[string]string{
+					"HostName":  "bastion2.example.com",
+					"ProxyJump": "admin@bastion1:2222",
+				},
+			},
+			{
+				Name: "*",
+				SSHConfig: map[string]string{
+					"User":           "default-user",
+					"Port":           "22022",
+					"ConnectTimeout": "5",
+					"ForwardAgent":   "yes",
+				},
+			},
+		},
+	}
+	logger := debuglogger.New(io.Discard, false, true)
+
+	c, err := newNativeSSHClientConfig(cfg, "web1", map[string]string{"port": "2200"}, logger, []string{})
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", c.HostName)
+	assert.Equal(t, "2200", c.Port)
+	assert.Equal(t, "web-user", c.User)
+	assert.Equal(t, []string{"~/.ssh/id_web"}, c.IdentityFiles)
+	assert.Equal(t, 5*time.Second, c.ConnectTimeout)
+	assert.True(t, c.ForwardAgent)
+
+	require.Len(t, c.ProxyJump, 2)
+	assert.Equal(t, "bastion1", c.ProxyJump[0].HostName)
+	assert.Equal(t, "2222", c.ProxyJump[0].Port)
+	assert.Equal(t, "admin", c.ProxyJump[0].User)
+	assert.Equal(t, "bastion2.example.com", c.ProxyJump[1].HostName)
+	assert.Equal(t, "22022", c.ProxyJump[1].Port)
+	assert.Equal(t, "default-user", c.ProxyJump[1].User)
+
+	c, err = newNativeSSHClientConfig(cfg, "user1@unknown", map[string]string{}, logger, []string{})
+	require.NoError(t, err)
+	assert.Equal(t, "unknown", c.HostName)
+	assert.Equal(t, "user1", c.User)
+	assert.Empty(t, c.ProxyJump)
+}
+
+func TestNewNativeSSHClientConfig_MultipleIdentityFiles(t *testing.T) {
+	cfg := &Config{
+		Hosts: []*Host{
+			{
+				Name: "web1",
+				SSHConfig: map[string]string{
+					"IdentityFile": "~/.ssh/id_web\n~/.ssh/id_web_old",
+					"User":         "web-user",
+				},
+			},
+			{
+				Name: "*",
+				SSHConfig: map[string]string{
+					"identityfile": "~/.ssh/id_default",
+					"User":         "default-user",
+				},
+			},
+		},
+	}
+	logger := debuglogger.New(io.Discard, false, true)
+
+	c, err := newNativeSSHClientConfig(cfg, "web1", map[string]string{}, logger, []string{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"~/.ssh/id_web", "~/.ssh/id_web_old", "~/.ssh/id_default"}, c.IdentityFiles)
+	assert.Equal(t, "web-user", c.User)
+
+	// the identity files of the options are tried first
+	c, err = newNativeSSHClientConfig(cfg, "web1", map[string]string{"identityfile": "~/.ssh/id_option"}, logger, []string{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"~/.ssh/id_option", "~/.ssh/id_web", "~/.ssh/id_web_old", "~/.ssh/id_default"}, c.IdentityFiles)
+}
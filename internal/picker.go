@@ -0,0 +1,275 @@
+package internal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// errPickerCanceled is returned when the picker is canceled by the user.
+var errPickerCanceled = errors.New("canceled")
+
+// pickerItem is a candidate of the picker.
+type pickerItem struct {
+	Name        string
+	Description string
+	Tags        []string
+}
+
+func (i *pickerItem) text() string {
+	return strings.Join(append([]string{i.Name, i.Description}, i.Tags...), " ")
+}
+
+// picker is a minimal fuzzy finder running on a terminal.
+// It reads key inputs from the reader and renders the candidates to the writer,
+// so that it can be tested with a fake terminal. The caller is responsible for putting the terminal in raw mode.
+type picker struct {
+	in      *bufio.Reader
+	out     io.Writer
+	items   []*pickerItem
+	height  int
+	noColor bool
+
+	query   []rune
+	matches []*pickerItem
+	cursor  int
+}
+
+func newPicker(in io.Reader, out io.Writer, items []*pickerItem, height int, noColor bool) *picker {
+	if height < 1 {
+		height = 1
+	}
+	p := &picker{
+		in:      bufio.NewReader(in),
+		out:     out,
+		items:   items,
+		height:  height,
+		noColor: noColor,
+	}
+	p.filter()
+	return p
+}
+
+// Run shows the picker and returns the selected item.
+// It returns errPickerCanceled if the user cancels it.
+func (p *picker) Run() (*pickerItem, error) {
+	defer p.clear()
+
+	for {
+		p.render()
+
+		r, _, err := p.in.ReadRune()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errPickerCanceled
+			}
+			return nil, err
+		}
+
+		switch r {
+		case '\r', '\n':
+			if len(p.matches) == 0 {
+				continue
+			}
+			return p.matches[p.cursor], nil
+		case 0x03, 0x07: // Ctrl-C, Ctrl-G
+			return nil, errPickerCanceled
+		case 0x04: // Ctrl-D
+			if len(p.query) == 0 {
+				return nil, errPickerCanceled
+			}
+		case 0x1b: // ESC
+			if p.in.Buffered() == 0 {
+				return nil, errPickerCanceled
+			}
+			p.handleEscapeSequence()
+		case 0x10, 0x0b: // Ctrl-P, Ctrl-K
+			p.moveCursor(-1)
+		case 0x0e: // Ctrl-N
+			p.moveCursor(1)
+		case 0x7f, 0x08: // Backspace
+			if len(p.query) > 0 {
+				p.query = p.query[:len(p.query)-1]
+				p.filter()
+			}
+		case 0x15: // Ctrl-U
+			p.query = p.query[:0]
+			p.filter()
+		case 0x17: // Ctrl-W
+			p.query = []rune(strings.TrimRightFunc(string(p.query), unicode.IsSpace))
+			i := strings.LastIndexFunc(string(p.query), unicode.IsSpace)
+			p.query = []rune(string(p.query)[:i+1])
+			p.filter()
+		default:
+			if unicode.IsPrint(r) {
+				p.query = append(p.query, r)
+				p.filter()
+			}
+		}
+	}
+}
+
+// handleEscapeSequence handles the arrow keys like "ESC [ A".
+func (p *picker) handleEscapeSequence() {
+	b, err := p.in.ReadByte()
+	if err != nil || (b != '[' && b != 'O') {
+		return
+	}
+	b, err = p.in.ReadByte()
+	if err != nil {
+		return
+	}
+	switch b {
+	case 'A':
+		p.moveCursor(-1)
+	case 'B':
+		p.moveCursor(1)
+	}
+}
+
+func (p *picker) moveCursor(delta int) {
+	p.cursor += delta
+	if p.cursor >= len(p.matches) {
+		p.cursor = len(p.matches) - 1
+	}
+	if p.cursor < 0 {
+		p.cursor = 0
+	}
+}
+
+// filter updates the candidates matched by the query.
+func (p *picker) filter() {
+	p.matches = fuzzyFilter(p.items, string(p.query))
+	p.cursor = 0
+}
+
+func (p *picker) render() {
+	var b strings.Builder
+	// go back to the prompt line and clear the previous output
+	b.WriteString("\r\x1b[J")
+
+	start := 0
+	if p.cursor >= p.height {
+		start = p.cursor - p.height + 1
+	}
+	end := min(start+p.height, len(p.matches))
+
+	nameWidth := 0
+	descriptionWidth := 0
+	for _, item := range p.matches[start:end] {
+		nameWidth = max(nameWidth, utf8.RuneCountInString(item.Name))
+		descriptionWidth = max(descriptionWidth, utf8.RuneCountInString(item.Description))
+	}
+
+	for i := start; i < end; i++ {
+		item := p.matches[i]
+		line := fmt.Sprintf("%s   %s   %s", padRight(item.Name, nameWidth), padRight(item.Description, descriptionWidth), strings.Join(item.Tags, ","))
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		b.WriteString("\r\n")
+		if i == p.cursor {
+			if p.noColor {
+				b.WriteString("> " + line)
+			} else {
+				b.WriteString("\x1b[7m> " + line + "\x1b[0m")
+			}
+		} else {
+			b.WriteString("  " + line)
+		}
+	}
+	b.WriteString(fmt.Sprintf("\r\n  %d/%d", len(p.matches), len(p.items)))
+
+	// move the cursor back to the prompt line
+	b.WriteString(fmt.Sprintf("\x1b[%dA\r", end-start+1))
+	b.WriteString("> " + string(p.query))
+
+	_, _ = io.WriteString(p.out, b.String())
+}
+
+// clear erases the picker from the terminal.
+func (p *picker) clear() {
+	_, _ = io.WriteString(p.out, "\r\x1b[J")
+}
+
+func padRight(s string, width int) string {
+	if n := utf8.RuneCountInString(s); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s
+}
+
+// fuzzyFilter returns the items matched by the query in order of relevance.
+// The query is split by whitespace, and every term must match the name, description or tags of an item as a
+// case-insensitive subsequence. Items whose matched characters are closer together and nearer the start rank higher.
+func fuzzyFilter(items []*pickerItem, query string) []*pickerItem {
+	terms := strings.Fields(strings.ToLower(query))
+
+	type scored struct {
+		item  *pickerItem
+		score int
+	}
+	matched := make([]scored, 0, len(items))
+	for _, item := range items {
+		text := []rune(strings.ToLower(item.text()))
+		score := 0
+		ok := true
+		for _, term := range terms {
+			s, found := fuzzyMatch(text, []rune(term))
+			if !found {
+				ok = false
+				break
+			}
+			score += s
+		}
+		if ok {
+			matched = append(matched, scored{item: item, score: score})
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].score < matched[j].score
+	})
+
+	ret := make([]*pickerItem, 0, len(matched))
+	for _, m := range matched {
+		ret = append(ret, m.item)
+	}
+	return ret
+}
+
+// fuzzyMatch reports whether the pattern is a subsequence of the text.
+// The score is based on the smallest width of the text spanned by the pattern, and then its start position.
+// Lower is better.
+func fuzzyMatch(text []rune, pattern []rune) (int, bool) {
+	if len(pattern) == 0 {
+		return 0, true
+	}
+
+	best := -1
+	for start := 0; start < len(text); start++ {
+		if text[start] != pattern[0] {
+			continue
+		}
+		j := 1
+		end := start
+		for i := start + 1; i < len(text) && j < len(pattern); i++ {
+			if text[i] == pattern[j] {
+				j++
+				end = i
+			}
+		}
+		if j < len(pattern) {
+			// no more matches from the later positions
+			break
+		}
+		score := (end-start+1)*1000 + start
+		if best < 0 || score < best {
+			best = score
+		}
+	}
+	return best, best >= 0
+}
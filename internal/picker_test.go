@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func testPickerItems() []*pickerItem {
+	return []*pickerItem{
+		{Name: "web1", Description: "web server 1", Tags: []string{"prod", "web"}},
+		{Name: "web2", Description: "web server 2", Tags: []string{"prod", "web", "canary"}},
+		{Name: "db1", Description: "database", Tags: []string{"prod", "db"}},
+		{Name: "dev", Description: "development"},
+	}
+}
+
+func TestFuzzyFilter(t *testing.T) {
+	testCases := []struct {
+		query    string
+		expected []string
+	}{
+		{query: "", expected: []string{"web1", "web2", "db1", "dev"}},
+		{query: "web", expected: []string{"web1", "web2"}},
+		{query: "w2", expected: []string{"web2"}},
+		{query: "DB", expected: []string{"db1", "web1", "web2"}},
+		{query: "canary", expected: []string{"web2"}},
+		{query: "prod server", expected: []string{"web1", "web2"}},
+		{query: "dvl", expected: []string{"dev"}},
+		{query: "se", expected: []string{"web1", "web2", "db1"}},
+		{query: "xyz", expected: []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			names := make([]string, 0)
+			for _, item := range fuzzyFilter(testPickerItems(), tc.query) {
+				names = append(names, item.Name)
+			}
+			assert.Equal(t, tc.expected, names)
+		})
+	}
+}
+
+func TestPicker_Run(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+		canceled bool
+	}{
+		{name: "select first", input: "\r", expected: "web1"},
+		{name: "query", input: "db\r", expected: "db1"},
+		{name: "arrow keys", input: "\x1b[B\x1b[B\x1b[A\r", expected: "web2"},
+		{name: "ctrl-n and ctrl-p", input: "\x0e\x0e\x0e\x0e\x0e\x10\r", expected: "db1"},
+		{name: "backspace", input: "dbx\x7f\x7f\x7fdev\r", expected: "dev"},
+		{name: "ctrl-u", input: "xyz\x15web\x0e\r", expected: "web2"},
+		{name: "no matches", input: "xyz\r\x7f\x7f\x7f\r", expected: "web1"},
+		{name: "ctrl-c", input: "web\x03", canceled: true},
+		{name: "esc", input: "\x1b", canceled: true},
+		{name: "eof", input: "web", canceled: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			item, err := newPicker(strings.NewReader(tc.input), out, testPickerItems(), 10, true).Run()
+			if tc.canceled {
+				assert.ErrorIs(t, err, errPickerCanceled)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, item.Name)
+		})
+	}
+}
+
+func TestPicker_Render(t *testing.T) {
+	out := &bytes.Buffer{}
+	p := newPicker(strings.NewReader(""), out, testPickerItems(), 2, true)
+	p.query = []rune("web")
+	p.filter()
+	p.moveCursor(1)
+	p.render()
+
+	assert.Equal(t, "\r\x1b[J"+
+		"\r\n  web1   web server 1   prod,web"+
+		"\r\n> web2   web server 2   prod,web,canary"+
+		"\r\n  2/4"+
+		"\x1b[3A\r> web", out.String())
+}
@@ -0,0 +1,24 @@
+package internal
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	out := &bytes.Buffer{}
+	w := newPrefixWriter(&sync.Mutex{}, out, "host1: ")
+
+	_, err := w.Write([]byte("hello\nwor"))
+	assert.NoError(t, err)
+	assert.Equal(t, "host1: hello\n", out.String())
+
+	_, err = w.Write([]byte("ld\nfoo"))
+	assert.NoError(t, err)
+	assert.Equal(t, "host1: hello\nhost1: world\n", out.String())
+
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "host1: hello\nhost1: world\nhost1: foo\n", out.String())
+}
@@ -2,21 +2,33 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/Songmu/wrapcommander"
 	"github.com/kohkimakimoto/xs/internal/debuglogger"
+	"github.com/kohkimakimoto/xs/internal/lualib/shell"
 	"github.com/urfave/cli/v3"
 	"github.com/yuin/gopher-lua"
 	"os"
 	"os/exec"
 	"runtime"
 	"strings"
+	"time"
 )
 
 func runAction(ctx context.Context, cmd *cli.Command) error {
-	logger := debuglogger.Get(cmd)
+	cfg, L, err := newConfig(cmd)
+	if err != nil {
+		return err
+	}
+	defer L.Close()
 
-	args := cmd.Args().Slice()
+	return runWithConfig(ctx, cmd, cfg, L, cmd.Args().Slice())
+}
+
+// runWithConfig connects to the destination with the arguments in the form of "[options] destination [command]".
+func runWithConfig(ctx context.Context, cmd *cli.Command, cfg *Config, L *lua.LState, args []string) error {
+	logger := debuglogger.Get(cmd)
 
 	// extract SSH options
 	var options []string
@@ -62,80 +74,64 @@ func runAction(ctx context.Context, cmd *cli.Command) error {
 		return fmt.Errorf("destination host is required")
 	}
 
-	tmpFile, err := os.CreateTemp("", "xs.ssh_config.*.tmp")
-	if err != nil {
-		return err
-	}
-	tmpSSHConfigFile := tmpFile.Name()
-	_ = tmpFile.Close()
-
-	defer func() {
-		_ = os.Remove(tmpSSHConfigFile)
-		logger.Printf("removed ssh config file: %s", tmpSSHConfigFile)
-	}()
-
-	logger.Printf("generated ssh config file: %s", tmpSSHConfigFile)
-
-	cfg, L, err := newConfig(cmd)
-	if err != nil {
-		return err
-	}
-	defer L.Close()
-
-	sshConfig, err := genSSHConfig(cfg)
+	sshConfigFile, removeSSHConfigFile, err := writeSSHConfigFile(cfg)
 	if err != nil {
 		return err
 	}
+	defer removeSSHConfigFile()
 
-	if err := os.WriteFile(tmpSSHConfigFile, sshConfig, 0644); err != nil {
-		return err
-	}
+	logger.Printf("generated ssh config file: %s", sshConfigFile)
 
 	hostname := extractHostname(params[0])
-	host := cfg.NewHostFilter().GetHostByName(hostname)
+	host := cfg.NewHostFilter().ExcludePatterns().GetHostByName(hostname)
 	if host == nil {
 		logger.Printf("host not found: %s", hostname)
 	} else {
 		logger.Printf("find host: %s", host.Name)
 	}
 
-	if host != nil {
-		if len(params) == 1 {
+	hookHosts := findHookHosts(cfg, host, hostname)
+	for _, h := range hookHosts {
+		if h.IsPattern() {
+			logger.Printf("find pattern host: %s", h.Name)
+		}
+	}
+	hooks := newConnectionHooks(hookHosts)
+	command := strings.Join(params[1:], " ")
+	hookCtx := newHookContext(cfg, host, params[0], options, command)
+	// It is determined before the on_after_connect hook script is appended to the params.
+	hasCommand := len(params) > 1
+
+	if len(hookHosts) > 0 {
+		if !hasCommand {
 			// If it runs without command (shell login), run hooks
-			if len(host.OnBeforeConnect) > 0 {
-				logger.Printf("run hooks: on_before_disconnect")
-				script, err := createHookScript(L, host.OnBeforeConnect)
-				if err != nil {
-					return err
-				}
-				logger.Printf("hook script (local):")
-				logger.PrintfNoPrefix("%s", script)
-				if err := runHookScript(script); err != nil {
+			if len(hooks.OnBeforeConnect) > 0 {
+				if err := runLocalHooks(cmd, L, "on_before_connect", hooks.OnBeforeConnect, hookCtx); err != nil {
 					return err
 				}
 			}
 
-			if len(host.OnAfterDisconnect) > 0 {
+			if len(hooks.OnAfterDisconnect) > 0 {
 				// register on_after_disconnect hooks
 				defer func() {
-					logger.Printf("run hooks: run on_after_disconnect")
-					script, err := createHookScript(L, host.OnAfterDisconnect)
-					if err != nil {
-						_, _ = fmt.Fprintf(cmd.ErrWriter, "failed to run on_after_disconnect: %v\n", err)
-					}
-					logger.Printf("hook script (local):")
-					logger.PrintfNoPrefix("%s", script)
-					if err := runHookScript(script); err != nil {
+					if err := runLocalHooks(cmd, L, "on_after_disconnect", hooks.OnAfterDisconnect, hookCtx); err != nil {
 						_, _ = fmt.Fprintf(cmd.ErrWriter, "failed to run on_after_disconnect: %v\n", err)
 					}
 				}()
 			}
 		}
 
-		if len(params) == 1 && len(host.OnAfterConnect) > 0 {
+		if hasCommand && len(hooks.OnBeforeCommand) > 0 {
+			// If it runs with command, run on_before_command hooks
+			if err := runLocalHooks(cmd, L, "on_before_command", hooks.OnBeforeCommand, hookCtx); err != nil {
+				return err
+			}
+		}
+
+		if !hasCommand && len(hooks.OnAfterConnect) > 0 {
 			// run on_after_connect hooks
 			logger.Printf("run hooks: run on_after_connect")
-			script, err := createHookScript(L, host.OnAfterConnect)
+			script, err := createHookScript(L, hooks.OnAfterConnect, hookCtx.toLuaTable(L))
 			if err != nil {
 				return err
 			}
@@ -163,7 +159,29 @@ func runAction(ctx context.Context, cmd *cli.Command) error {
 		}
 	}
 
-	sshCommandArgs := []string{"-F", tmpSSHConfigFile}
+	startTime := time.Now()
+	err = runSSH(cmd, cfg, sshConfigFile, options, params)
+	// The result is also referred by the on_after_disconnect hooks registered by defer.
+	hookCtx.setResult(err, time.Since(startTime))
+
+	if hasCommand && len(hooks.OnAfterCommand) > 0 {
+		// run on_after_command hooks with the exit code of the command
+		if hookErr := runLocalHooks(cmd, L, "on_after_command", hooks.OnAfterCommand, hookCtx); hookErr != nil {
+			_, _ = fmt.Fprintf(cmd.ErrWriter, "failed to run on_after_command: %v\n", hookErr)
+		}
+	}
+	return err
+}
+
+// runSSH connects to the destination by the ssh command, or by the native ssh client if it is enabled.
+func runSSH(cmd *cli.Command, cfg *Config, sshConfigFile string, options []string, params []string) error {
+	logger := debuglogger.Get(cmd)
+
+	if getSSHClientFlag() == sshClientNative {
+		return runNativeSSH(cmd, cfg, options, params)
+	}
+
+	sshCommandArgs := []string{"-F", sshConfigFile}
 	sshCommandArgs = append(sshCommandArgs, options...)
 	sshCommandArgs = append(sshCommandArgs, params...)
 	eCmd := exec.Command("ssh", sshCommandArgs...)
@@ -173,13 +191,63 @@ func runAction(ctx context.Context, cmd *cli.Command) error {
 
 	logger.Printf("underlying ssh command: %v", eCmd.Args)
 
-	if err = eCmd.Run(); err != nil {
+	if err := eCmd.Run(); err != nil {
 		return cli.Exit(err, wrapcommander.ResolveExitCode(err))
 	}
 	return nil
 }
 
-func createHookScript(L *lua.LState, hooks []any) (string, error) {
+// resolveExitCode returns the exit code that the error of runSSH represents.
+func resolveExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitCoder cli.ExitCoder
+	if errors.As(err, &exitCoder) {
+		return exitCoder.ExitCode()
+	}
+	return 1
+}
+
+// findHookHosts returns the hosts whose hooks apply to the destination.
+// They are the concrete host and the pattern hosts that match the hostname, in the same order as the generated ssh_config.
+func findHookHosts(cfg *Config, host *Host, hostname string) []*Host {
+	hosts := make([]*Host, 0)
+	if host != nil {
+		hosts = append(hosts, host)
+	}
+	for _, h := range sortHostsForSSHConfig(cfg.Hosts) {
+		if h.IsPattern() && h.MatchesHostname(hostname) {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// connectionHooks holds the hooks to run for a connection.
+type connectionHooks struct {
+	OnBeforeConnect   []any
+	OnAfterConnect    []any
+	OnAfterDisconnect []any
+	OnBeforeCommand   []any
+	OnAfterCommand    []any
+}
+
+func newConnectionHooks(hosts []*Host) *connectionHooks {
+	hooks := &connectionHooks{}
+	for _, h := range hosts {
+		hooks.OnBeforeConnect = append(hooks.OnBeforeConnect, h.OnBeforeConnect...)
+		hooks.OnAfterConnect = append(hooks.OnAfterConnect, h.OnAfterConnect...)
+		hooks.OnAfterDisconnect = append(hooks.OnAfterDisconnect, h.OnAfterDisconnect...)
+		hooks.OnBeforeCommand = append(hooks.OnBeforeCommand, h.OnBeforeCommand...)
+		hooks.OnAfterCommand = append(hooks.OnAfterCommand, h.OnAfterCommand...)
+	}
+	return hooks
+}
+
+// createHookScript evaluates the hooks and returns the shell script to run.
+// The args are passed to the hooks defined as Lua functions.
+func createHookScript(L *lua.LState, hooks []any, args ...lua.LValue) (string, error) {
 	if len(hooks) == 0 {
 		return "", nil
 	}
@@ -192,20 +260,31 @@ func createHookScript(L *lua.LState, hooks []any) (string, error) {
 				Fn:      hookFn,
 				NRet:    1,
 				Protect: true,
-			}); err != nil {
+			}, args...); err != nil {
 				return "", err
 			}
 
 			ret := L.Get(-1) // returned value
 			L.Pop(1)
 
-			// assuming that the return value is a string
-			code = lua.LVAsString(ret)
+			if tb, ok := ret.(*lua.LTable); ok {
+				// the return value is an argv list
+				argv, err := shell.ToArgv(tb)
+				if err != nil {
+					return "", err
+				}
+				code = shell.Join(argv)
+			} else {
+				// assuming that the return value is a string
+				code = lua.LVAsString(ret)
+			}
 		} else if hookStr, ok := hook.(lua.LString); ok {
 			code = lua.LVAsString(hookStr)
+		} else if argv, ok := hook.([]string); ok {
+			code = shell.Join(argv)
 		} else {
-			// never reach here if I implemented correctly.
-			panic("unexpected hook type")
+			// The hosts restored from the cache of the config have only the number of the hooks as nil.
+			return "", fmt.Errorf("unexpected hook type %T", hook)
 		}
 		if code != "" {
 			codeSlice = append(codeSlice, code)
@@ -215,17 +294,26 @@ func createHookScript(L *lua.LState, hooks []any) (string, error) {
 	return strings.Join(codeSlice, "\n"), nil
 }
 
+// runLocalHooks evaluates the hooks and runs the script on the local machine.
+func runLocalHooks(cmd *cli.Command, L *lua.LState, name string, hooks []any, hookCtx *hookContext) error {
+	logger := debuglogger.Get(cmd)
+
+	logger.Printf("run hooks: run %s", name)
+	script, err := createHookScript(L, hooks, hookCtx.toLuaTable(L))
+	if err != nil {
+		return err
+	}
+	logger.Printf("hook script (local):")
+	logger.PrintfNoPrefix("%s", script)
+	return runHookScript(script)
+}
+
 func runHookScript(script string) error {
 	if script == "" {
 		return nil
 	}
 
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.Command("cmd", "/c", script)
-	} else {
-		cmd = exec.Command("sh", "-c", script)
-	}
+	cmd := newHookScriptCommand(script)
 	cmd.Stderr = os.Stderr
 	cmd.Stdout = os.Stdout
 	cmd.Stdin = os.Stdin
@@ -233,19 +321,37 @@ func runHookScript(script string) error {
 	return cmd.Run()
 }
 
+// newHookScriptCommand returns the command to run the hook script by the shell of the platform.
+func newHookScriptCommand(script string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/c", script)
+	}
+	return exec.Command("sh", "-c", script)
+}
+
 // extractHostname extracts hostname from the destination format like below:
 // ssh://[user@]hostname[:port]
 // [user@]hostname[:port]
 
 func extractHostname(hostname string) string {
-	hostname = strings.TrimPrefix(hostname, "ssh://")
+	_, hostname, _ = parseDestination(hostname)
+	return hostname
+}
+
+// parseDestination parses the destination format like below into user, hostname and port:
+// ssh://[user@]hostname[:port]
+// [user@]hostname[:port]
+func parseDestination(destination string) (user string, hostname string, port string) {
+	hostname = strings.TrimPrefix(destination, "ssh://")
 	if strings.Contains(hostname, "@") {
 		s := strings.SplitN(hostname, "@", 2)
+		user = s[0]
 		hostname = s[1]
 	}
 	if strings.Contains(hostname, ":") {
 		s := strings.SplitN(hostname, ":", 2)
 		hostname = s[0]
+		port = s[1]
 	}
-	return hostname
+	return user, hostname, port
 }
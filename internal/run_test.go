@@ -1,6 +1,18 @@
 package internal
 
-import "testing"
+import (
+	"context"
+	"github.com/kohkimakimoto/xs/internal/debuglogger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v3"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
 
 func TestExtractHostname(t *testing.T) {
 	testCases := []struct {
@@ -48,3 +60,133 @@ func TestExtractHostname(t *testing.T) {
 		}
 	}
 }
+
+func TestFindHookHosts(t *testing.T) {
+	host1 := &Host{Name: "host1"}
+	internal := &Host{Name: "*.internal"}
+	all := &Host{Name: "* !bastion"}
+	match := &Host{Name: "corp", Match: "host *"}
+	cfg := &Config{
+		Hosts: []*Host{all, internal, match, host1},
+	}
+
+	assert.Equal(t, []*Host{host1, all}, findHookHosts(cfg, host1, "host1"))
+	assert.Equal(t, []*Host{all, internal}, findHookHosts(cfg, nil, "web1.internal"))
+	assert.Equal(t, []*Host{}, findHookHosts(cfg, nil, "bastion"))
+}
+
+func TestCreateHookScript(t *testing.T) {
+	L := newLState()
+	defer L.Close()
+
+	err := L.DoString(`
+host "host1" {
+  on_after_command = {
+    "echo string hook",
+    function(ctx) return "echo " .. ctx.command .. " " .. ctx.exit_code end,
+    {"echo", "argv hook", "it's"},
+    function(ctx) return {"echo", ctx.command .. " done"} end,
+  },
+}
+`)
+	assert.NoError(t, err)
+
+	h := getConfigFromLState(L).NewHostFilter().GetHostByName("host1")
+	hookCtx := &hookContext{Host: h, Command: "uptime"}
+	hookCtx.setResult(cli.Exit("", 2), 0)
+	script, err := createHookScript(L, h.OnAfterCommand, hookCtx.toLuaTable(L))
+	assert.NoError(t, err)
+	assert.Equal(t, "echo string hook\necho uptime 2\necho 'argv hook' 'it'\\''s'\necho 'uptime done'", script)
+
+	err = L.DoString(`host "host2" { on_before_connect = { {"echo", {}} } }`)
+	assert.ErrorContains(t, err, "on_before_connect has an invalid hook: argv must be an array of strings but #2 is table")
+
+	// the hosts restored from the cache do not have the hooks themselves
+	cached := newListItem(h).toHost()
+	_, err = createHookScript(L, cached.OnAfterCommand, hookCtx.toLuaTable(L))
+	assert.EqualError(t, err, "unexpected hook type <nil>")
+}
+
+func TestNewHookContext(t *testing.T) {
+	host1 := &Host{
+		Name: "host1",
+		SSHConfig: map[string]string{
+			"User": "config-user",
+			"Port": "2222",
+		},
+	}
+	cfg := &Config{Hosts: []*Host{host1}}
+
+	c := newHookContext(cfg, host1, "host1", []string{"-A"}, "")
+	assert.Equal(t, "config-user", c.User)
+	assert.Equal(t, "2222", c.Port)
+
+	c = newHookContext(cfg, host1, "host1", []string{"-l", "option-user", "-p", "22"}, "uptime")
+	assert.Equal(t, "option-user", c.User)
+	assert.Equal(t, "22", c.Port)
+	assert.Equal(t, "uptime", c.Command)
+
+	c = newHookContext(cfg, host1, "ssh://dest-user@host1:2200", []string{"-l", "option-user"}, "")
+	assert.Equal(t, "dest-user", c.User)
+	assert.Equal(t, "2200", c.Port)
+	assert.Equal(t, "host1", c.Hostname)
+}
+
+// installFakeSSH puts the fake ssh command that records its arguments into PATH.
+// It returns the path of the file that the arguments are written to, one invocation per line.
+func installFakeSSH(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ssh command is a shell script")
+	}
+	t.Setenv("XS_SSH_CLIENT", "")
+
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "ssh.args")
+	script := "#!/bin/sh\necho \"$*\" >> " + argsFile + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ssh"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return argsFile
+}
+
+func newTestCommand() *cli.Command {
+	cmd := &cli.Command{Metadata: map[string]any{}, Writer: io.Discard, ErrWriter: io.Discard}
+	debuglogger.Bind(cmd, debuglogger.New(io.Discard, false, true))
+	return cmd
+}
+
+func TestRunWithConfig_Hooks(t *testing.T) {
+	installFakeSSH(t)
+	dir := t.TempDir()
+	hooksFile := filepath.Join(dir, "hooks.log")
+	configFile := filepath.Join(dir, "config.lua")
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+local log = "`+hooksFile+`"
+host "web1" {
+  on_before_connect = { "echo before_connect >> " .. log },
+  on_after_connect = { "echo after_connect" },
+  on_after_disconnect = { "echo after_disconnect >> " .. log },
+  on_before_command = { function(ctx) return "echo before_command " .. ctx.command .. " >> " .. log end },
+  on_after_command = { function(ctx) return "echo after_command " .. ctx.command .. " >> " .. log end },
+}
+`), 0644))
+
+	cmd := newTestCommand()
+	cfg, L, err := loadConfig([]string{configFile}, debuglogger.Get(cmd))
+	require.NoError(t, err)
+	defer L.Close()
+
+	readHooks := func() []string {
+		b, err := os.ReadFile(hooksFile)
+		require.NoError(t, err)
+		require.NoError(t, os.Remove(hooksFile))
+		return strings.Split(strings.TrimSpace(string(b)), "\n")
+	}
+
+	// The command hooks do not run for the shell login even if the on_after_connect hook is set.
+	require.NoError(t, runWithConfig(context.Background(), cmd, cfg, L, []string{"web1"}))
+	assert.Equal(t, []string{"before_connect", "after_disconnect"}, readHooks())
+
+	require.NoError(t, runWithConfig(context.Background(), cmd, cfg, L, []string{"web1", "uptime"}))
+	assert.Equal(t, []string{"before_command uptime", "after_command uptime"}, readHooks())
+}
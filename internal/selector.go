@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// HostSelector selects hosts by a selector expression.
+//
+// A selector expression consists of terms separated by whitespace.
+// A host is selected when it matches all the terms.
+// Each term is a comma-separated list of patterns, and a term matches when any of the patterns matches.
+// A term prefixed with "!" is negated.
+//
+// A pattern is either a host name pattern like "web-*" or a tag pattern like "tag:prod".
+// Both support glob patterns.
+//
+// Example:
+//
+//	tag:prod,tag:web !tag:canary
+//
+// selects hosts that have the "prod" or "web" tag and do not have the "canary" tag.
+type HostSelector struct {
+	terms []*selectorTerm
+}
+
+type selectorTerm struct {
+	negate   bool
+	patterns []string
+}
+
+const tagPatternPrefix = "tag:"
+
+func ParseHostSelector(expr string) (*HostSelector, error) {
+	fields := strings.Fields(expr)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty host selector")
+	}
+
+	s := &HostSelector{}
+	for _, field := range fields {
+		term := &selectorTerm{}
+		if strings.HasPrefix(field, "!") {
+			term.negate = true
+			field = field[1:]
+		}
+		for _, pattern := range strings.Split(field, ",") {
+			if pattern == "" || pattern == tagPatternPrefix {
+				return nil, fmt.Errorf("invalid host selector %q: empty pattern", expr)
+			}
+			if _, err := path.Match(strings.TrimPrefix(pattern, tagPatternPrefix), ""); err != nil {
+				return nil, fmt.Errorf("invalid host selector %q: bad pattern %q", expr, pattern)
+			}
+			term.patterns = append(term.patterns, pattern)
+		}
+		s.terms = append(s.terms, term)
+	}
+	return s, nil
+}
+
+// Match reports whether the host is selected by the selector.
+func (s *HostSelector) Match(h *Host) bool {
+	for _, term := range s.terms {
+		if term.match(h) == term.negate {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *selectorTerm) match(h *Host) bool {
+	for _, pattern := range t.patterns {
+		if tagPattern, ok := strings.CutPrefix(pattern, tagPatternPrefix); ok {
+			for _, tag := range h.Tags {
+				if matched, _ := path.Match(tagPattern, tag); matched {
+					return true
+				}
+			}
+		} else if matched, _ := path.Match(pattern, h.Name); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHostSelector_Match(t *testing.T) {
+	web1 := &Host{Name: "web1", Tags: []string{"prod", "web"}}
+	web2 := &Host{Name: "web2", Tags: []string{"prod", "web", "canary"}}
+	db1 := &Host{Name: "db1", Tags: []string{"prod", "db"}}
+	dev1 := &Host{Name: "dev1", Tags: []string{"dev", "web"}}
+	hosts := []*Host{web1, web2, db1, dev1}
+
+	testCases := []struct {
+		expr     string
+		expected []string
+	}{
+		{expr: "web1", expected: []string{"web1"}},
+		{expr: "web*", expected: []string{"web1", "web2"}},
+		{expr: "web1,db1", expected: []string{"web1", "db1"}},
+		{expr: "tag:prod", expected: []string{"web1", "web2", "db1"}},
+		{expr: "tag:prod tag:web", expected: []string{"web1", "web2"}},
+		{expr: "tag:prod,tag:web !tag:canary", expected: []string{"web1", "db1", "dev1"}},
+		{expr: "!tag:prod", expected: []string{"dev1"}},
+		{expr: "tag:d*", expected: []string{"db1", "dev1"}},
+		{expr: "tag:unknown", expected: []string{}},
+	}
+
+	for _, testCase := range testCases {
+		s, err := ParseHostSelector(testCase.expr)
+		assert.NoError(t, err)
+		actual := make([]string, 0)
+		for _, h := range hosts {
+			if s.Match(h) {
+				actual = append(actual, h.Name)
+			}
+		}
+		assert.Equal(t, testCase.expected, actual, testCase.expr)
+	}
+}
+
+func TestParseHostSelector_Error(t *testing.T) {
+	for _, expr := range []string{"", "  ", "!", "web1,", "tag:", "[web"} {
+		_, err := ParseHostSelector(expr)
+		assert.Error(t, err, expr)
+	}
+}
@@ -2,21 +2,71 @@ package internal
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
 	"text/template"
+	"time"
 )
 
-var sshConfigTemplate = template.Must(template.New("ssh_config").Parse(`# The configuration is generated by xs with the config file: {{ .ConfigFile }}
-
-{{range $i, $host := .Hosts -}}
-Host {{$host.Name}}{{range $ii, $param := $host.SortedSSHConfig}}{{range $k, $v := $param}}
+var sshConfigTemplate = template.Must(template.New("ssh_config").Parse(`{{define "hosts"}}{{range $i, $host := . -}}
+{{if $host.Match}}Match {{$host.Match}}{{else}}Host {{$host.Name}}{{end}}{{range $ii, $param := $host.SortedSSHConfig}}{{range $k, $v := $param}}
     {{$k}} {{$v}}{{end}}{{end}}
 
-{{end -}}`))
+{{end}}{{end -}}
+# The configuration is generated by xs with the config file: {{ .ConfigFile }}
+
+{{template "hosts" .ConcreteHosts -}}
+{{if .Includes -}}
+Match all
+{{- range .Includes}}
+    Include {{.}}{{end}}
+
+{{end -}}
+{{template "hosts" .PatternHosts -}}`))
 
 func genSSHConfig(cfg *Config) ([]byte, error) {
+	// The imported hosts are not output because the ssh_config files are included as they are.
+	hosts := make([]*Host, 0, len(cfg.Hosts))
+	for _, h := range sortHostsForSSHConfig(cfg.Hosts) {
+		if h.ImportedFrom == "" {
+			hosts = append(hosts, h)
+		}
+	}
+	if cfg.Multiplex != nil {
+		if err := prepareMultiplexDir(); err != nil {
+			return nil, err
+		}
+		hosts = cfg.Multiplex.multiplexHosts(cfg, hosts)
+	}
+	// "Match all" makes the Include directives unconditional.
+	// They are placed after the concrete hosts so that the hosts defined in Lua take precedence,
+	// and before the pattern hosts so that a pattern like "Host *" does not override the included hosts.
+	includes := make([]string, 0, len(cfg.SSHConfigIncludes))
+	for _, include := range cfg.SSHConfigIncludes {
+		if strings.ContainsAny(include, " \t") {
+			include = `"` + include + `"`
+		}
+		includes = append(includes, include)
+	}
+
+	concreteHosts := make([]*Host, 0, len(hosts))
+	patternHosts := make([]*Host, 0, len(hosts))
+	for _, h := range hosts {
+		if h.IsPattern() {
+			patternHosts = append(patternHosts, h)
+		} else {
+			concreteHosts = append(concreteHosts, h)
+		}
+	}
+
 	input := map[string]interface{}{
-		"ConfigFile": cfg.Filepath,
-		"Hosts":      cfg.Hosts,
+		"ConfigFile":    cfg.FilepathsString(),
+		"ConcreteHosts": concreteHosts,
+		"Includes":      includes,
+		"PatternHosts":  patternHosts,
 	}
 	var b bytes.Buffer
 	if err := sshConfigTemplate.Execute(&b, input); err != nil {
@@ -24,3 +74,115 @@ func genSSHConfig(cfg *Config) ([]byte, error) {
 	}
 	return b.Bytes(), nil
 }
+
+// sortHostsForSSHConfig returns the hosts in the order to output to the ssh_config.
+// Because ssh uses the first obtained value for each parameter, the concrete hosts are placed before the pattern hosts.
+// The hosts imported from the included ssh_config files are placed between them like the Include directives.
+// The order of declaration is kept within each group.
+func sortHostsForSSHConfig(hosts []*Host) []*Host {
+	sorted := make([]*Host, 0, len(hosts))
+	for _, h := range hosts {
+		if h.ImportedFrom == "" && !h.IsPattern() {
+			sorted = append(sorted, h)
+		}
+	}
+	for _, h := range hosts {
+		if h.ImportedFrom != "" {
+			sorted = append(sorted, h)
+		}
+	}
+	for _, h := range hosts {
+		if h.ImportedFrom == "" && h.IsPattern() {
+			sorted = append(sorted, h)
+		}
+	}
+	return sorted
+}
+
+// writeSSHConfigFile generates ssh_config from the config and writes it to a file to pass to the ssh command.
+// It writes to the stable path if xs.stable_ssh_config is set, otherwise to a temporary file.
+// The returned function removes the temporary file, and does nothing for the stable path.
+func writeSSHConfigFile(cfg *Config) (string, func(), error) {
+	if cfg.StableSSHConfig {
+		file, err := writeStableSSHConfigFile(cfg)
+		if err != nil {
+			return "", nil, err
+		}
+		return file, func() {}, nil
+	}
+
+	file, err := writeTempSSHConfigFile(cfg)
+	if err != nil {
+		return "", nil, err
+	}
+	return file, func() {
+		_ = os.Remove(file)
+		cfg.DebugLogger.Printf("removed ssh config file: %s", file)
+	}, nil
+}
+
+// writeTempSSHConfigFile generates ssh_config from the config and writes it to a temporary file.
+// It returns the path of the file. The caller is responsible for removing it.
+func writeTempSSHConfigFile(cfg *Config) (string, error) {
+	sshConfig, err := genSSHConfig(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	tmpFile, err := os.CreateTemp("", "xs.ssh_config.*.tmp")
+	if err != nil {
+		return "", err
+	}
+	tmpSSHConfigFile := tmpFile.Name()
+	_ = tmpFile.Close()
+
+	if err := os.WriteFile(tmpSSHConfigFile, sshConfig, 0600); err != nil {
+		_ = os.Remove(tmpSSHConfigFile)
+		return "", err
+	}
+	return tmpSSHConfigFile, nil
+}
+
+// stableSSHConfigExpiration is the time after which the unused files in the stable ssh_config directory are removed.
+const stableSSHConfigExpiration = 7 * 24 * time.Hour
+
+// writeStableSSHConfigFile generates ssh_config from the config and writes it to the path named by the hash of
+// the content in ~/.xs/ssh_config. The same content is always written to the same path, so the file is not removed
+// after the ssh command exits, and it does not leak even if xs is killed.
+// The file is replaced atomically and readable only by the user.
+func writeStableSSHConfigFile(cfg *Config) (string, error) {
+	sshConfig, err := genSSHConfig(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	dir := getSSHConfigDir()
+	sum := sha256.Sum256(sshConfig)
+	file := filepath.Join(dir, "ssh_config."+hex.EncodeToString(sum[:8]))
+	if existing, err := os.ReadFile(file); err == nil && bytes.Equal(existing, sshConfig) {
+		// The modification time tells that the file is in use.
+		now := time.Now()
+		_ = os.Chtimes(file, now, now)
+	} else if err := writeFileAtomic(file, sshConfig, 0600); err != nil {
+		return "", err
+	}
+
+	pruneStableSSHConfigFiles(dir, file)
+	return file, nil
+}
+
+// pruneStableSSHConfigFiles removes the files in the directory that have not been used for a while except the current one.
+func pruneStableSSHConfigFiles(dir string, current string) {
+	files, err := filepath.Glob(filepath.Join(dir, "ssh_config.*"))
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		if file == current {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil && time.Since(info.ModTime()) > stableSSHConfigExpiration {
+			_ = os.Remove(file)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// cumulativeSSHConfigKeywords is the list of the keywords whose values are accumulated instead of the first obtained
+// value being used, in lower case.
+var cumulativeSSHConfigKeywords = []string{
+	"certificatefile",
+	"dynamicforward",
+	"identityfile",
+	"localforward",
+	"remoteforward",
+	"sendenv",
+	"setenv",
+}
+
+// sshConfigParam is a line of ssh_config.
+type sshConfigParam struct {
+	Keyword string
+	Value   string
+}
+
+// sshConfigSection is a "Host" or "Match" section of ssh_config.
+// The lines before the first "Host" or "Match" line are in the section of "Host *".
+type sshConfigSection struct {
+	Host   string
+	Match  string
+	Params []*sshConfigParam
+}
+
+// isUnconditional reports whether the section applies to all hosts.
+func (s *sshConfigSection) isUnconditional() bool {
+	return s.Host == "*" || strings.EqualFold(s.Match, "all")
+}
+
+// sshConfigImporter converts ssh_config files into the Lua DSL.
+type sshConfigImporter struct {
+	sections []*sshConfigSection
+	// Warnings are the notes about the parts that can not be converted exactly.
+	Warnings []string
+}
+
+// parseFile parses the ssh_config file and appends its sections.
+// Include directives in the sections that apply to all hosts are expanded in place.
+func (im *sshConfigImporter) parseFile(file string, current *sshConfigSection, depth int) (*sshConfigSection, error) {
+	if depth > maxSSHConfigIncludeDepth {
+		return nil, fmt.Errorf("too many nested Include directives in %s", file)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		keyword, value := parseSSHConfigLine(scanner.Text())
+		if keyword == "" {
+			continue
+		}
+
+		switch strings.ToLower(keyword) {
+		case "host":
+			current = &sshConfigSection{Host: value}
+			im.sections = append(im.sections, current)
+		case "match":
+			current = &sshConfigSection{Match: value}
+			im.sections = append(im.sections, current)
+		case "include":
+			if !current.isUnconditional() {
+				im.Warnings = append(im.Warnings, fmt.Sprintf("Include %s in a conditional section is skipped (%s)", value, file))
+				continue
+			}
+			parent := current
+			for _, path := range strings.Fields(value) {
+				files, err := filepath.Glob(resolveSSHConfigPath(strings.Trim(path, `"`)))
+				if err != nil {
+					return nil, fmt.Errorf("invalid ssh_config file path %s: %w", path, err)
+				}
+				for _, included := range files {
+					if current, err = im.parseFile(included, current, depth+1); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if current != parent {
+				// Like ssh, the lines after the Include directive belong to the section that includes the files.
+				current = &sshConfigSection{Host: parent.Host, Match: parent.Match}
+				im.sections = append(im.sections, current)
+			}
+		default:
+			current.Params = append(current.Params, &sshConfigParam{Keyword: keyword, Value: value})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return current, nil
+}
+
+// importedHost is a host converted from the sections of ssh_config.
+type importedHost struct {
+	Name   string
+	Match  string
+	Params []*sshConfigParam
+}
+
+// hosts converts the sections into the hosts.
+//
+// The generated ssh_config places the concrete hosts before the pattern hosts, while ssh uses the first obtained value
+// for each parameter. So the parameters of a concrete host that are overridden by the preceding sections are dropped
+// to keep the semantics. A "Host" line with multiple concrete names is split into the hosts of each name,
+// and the sections of the same concrete name are merged.
+func (im *sshConfigImporter) hosts() []*importedHost {
+	hosts := make([]*importedHost, 0)
+	concretes := map[string]*importedHost{}
+	names := map[string]int{}
+	matches := 0
+
+	for i, section := range im.sections {
+		if len(section.Params) == 0 {
+			continue
+		}
+
+		if section.Host != "" && isConcreteHostList(section.Host) {
+			for _, name := range strings.Fields(section.Host) {
+				h, ok := concretes[name]
+				if !ok {
+					h = &importedHost{Name: name}
+					concretes[name] = h
+					hosts = append(hosts, h)
+				}
+				for _, p := range section.Params {
+					if im.isOverridden(name, p.Keyword, i) || (!isCumulativeSSHConfigKeyword(p.Keyword) && h.has(p.Keyword)) {
+						continue
+					}
+					h.Params = append(h.Params, p)
+				}
+			}
+			continue
+		}
+
+		h := &importedHost{Params: section.Params}
+		if section.Match != "" {
+			matches++
+			h.Name = fmt.Sprintf("match-%d", matches)
+			h.Match = section.Match
+		} else {
+			h.Name = section.Host
+			if names[section.Host] > 0 {
+				// A host name must be unique, so the section is converted into the equivalent "Match" section.
+				h.Name = fmt.Sprintf("%s (%d)", section.Host, names[section.Host]+1)
+				h.Match = "originalhost " + strings.Join(strings.Fields(section.Host), ",")
+			}
+			names[section.Host]++
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts
+}
+
+// isOverridden reports whether the preceding sections of the index set the keyword for the host name.
+func (im *sshConfigImporter) isOverridden(name string, keyword string, index int) bool {
+	if isCumulativeSSHConfigKeyword(keyword) {
+		return false
+	}
+	for _, section := range im.sections[:index] {
+		applies := false
+		if section.Host != "" {
+			// the sections of the same name are merged in the order of appearance
+			applies = !isConcreteHostList(section.Host) && matchSSHPatternList(section.Host, name)
+		} else if section.isUnconditional() {
+			applies = true
+		}
+		if !applies {
+			if section.Match != "" && !section.isUnconditional() && slices.ContainsFunc(section.Params, func(p *sshConfigParam) bool {
+				return strings.EqualFold(p.Keyword, keyword)
+			}) {
+				im.addWarning(fmt.Sprintf("%s of %s may be overridden by the preceding \"Match %s\" section in ssh", keyword, name, section.Match))
+			}
+			continue
+		}
+		for _, p := range section.Params {
+			if strings.EqualFold(p.Keyword, keyword) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (im *sshConfigImporter) addWarning(warning string) {
+	if !slices.Contains(im.Warnings, warning) {
+		im.Warnings = append(im.Warnings, warning)
+	}
+}
+
+func (h *importedHost) has(keyword string) bool {
+	return slices.ContainsFunc(h.Params, func(p *sshConfigParam) bool {
+		return strings.EqualFold(p.Keyword, keyword)
+	})
+}
+
+// isConcreteHostList reports whether the "Host" patterns are the list of concrete host names like "web1 web2".
+func isConcreteHostList(patterns string) bool {
+	for _, name := range strings.Fields(patterns) {
+		if isSSHPattern(name) {
+			return false
+		}
+	}
+	return true
+}
+
+func isCumulativeSSHConfigKeyword(keyword string) bool {
+	return slices.Contains(cumulativeSSHConfigKeywords, strings.ToLower(keyword))
+}
+
+// importSSHConfig converts the ssh_config file into the Lua DSL of XS.
+func importSSHConfig(file string) (string, []string, error) {
+	im := &sshConfigImporter{}
+	global := &sshConfigSection{Host: "*"}
+	im.sections = append(im.sections, global)
+	if _, err := im.parseFile(file, global, 0); err != nil {
+		return "", nil, err
+	}
+
+	hosts := im.hosts()
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "-- Imported from %s by xs import\n", file)
+	for _, w := range im.Warnings {
+		_, _ = fmt.Fprintf(&b, "-- WARNING: %s\n", w)
+	}
+	for _, h := range hosts {
+		b.WriteString("\n")
+		writeLuaHost(&b, h)
+	}
+	return b.String(), im.Warnings, nil
+}
+
+func writeLuaHost(b *strings.Builder, h *importedHost) {
+	_, _ = fmt.Fprintf(b, "host %s {\n", luaQuote(h.Name))
+	if h.Match != "" {
+		_, _ = fmt.Fprintf(b, "  match = %s,\n", luaQuote(h.Match))
+	}
+
+	// group the values by the keywords in the order of appearance
+	keywords := make([]string, 0)
+	values := map[string][]string{}
+	for _, p := range h.Params {
+		key := strings.ToLower(p.Keyword)
+		if _, ok := values[key]; !ok {
+			keywords = append(keywords, p.Keyword)
+		}
+		values[key] = append(values[key], p.Value)
+	}
+
+	b.WriteString("  ssh_config = {\n")
+	for _, keyword := range keywords {
+		vs := values[strings.ToLower(keyword)]
+		if len(vs) == 1 {
+			_, _ = fmt.Fprintf(b, "    %s = %s,\n", luaTableKey(keyword), luaQuote(vs[0]))
+			continue
+		}
+		quoted := make([]string, 0, len(vs))
+		for _, v := range vs {
+			quoted = append(quoted, luaQuote(v))
+		}
+		_, _ = fmt.Fprintf(b, "    %s = { %s },\n", luaTableKey(keyword), strings.Join(quoted, ", "))
+	}
+	b.WriteString("  },\n")
+	b.WriteString("}\n")
+}
+
+// luaQuote returns the Lua string literal of the string.
+func luaQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// luaTableKey returns the key of a Lua table constructor. It is quoted if it is not a valid identifier.
+func luaTableKey(key string) string {
+	valid := key != ""
+	for i, c := range key {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			valid = false
+			break
+		}
+	}
+	if valid && !slices.Contains(luaReservedWords, key) {
+		return key
+	}
+	return "[" + luaQuote(key) + "]"
+}
+
+var luaReservedWords = []string{
+	"and", "break", "do", "else", "elseif", "end", "false", "for", "function", "if", "in",
+	"local", "nil", "not", "or", "repeat", "return", "then", "true", "until", "while",
+}
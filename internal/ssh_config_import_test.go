@@ -0,0 +1,156 @@
+package internal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+const testImportSSHConfig = `# global
+User globaluser
+Host web1 web2
+    HostName 10.0.0.%h
+    User deploy
+    IdentityFile ~/.ssh/id_web
+Host web*
+    Port 2222
+    User webuser
+Host db1
+    User dbuser
+    Port 5432
+Match host db1
+    ForwardAgent yes
+Host web1
+    Port 22
+    IdentityFile ~/.ssh/id_extra
+    SetEnv FOO="a b"
+Host web*
+    Compression yes
+Host db*
+    Include other.conf
+`
+
+func TestImportSSHConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(file, []byte(testImportSSHConfig), 0644))
+
+	lua, warnings, err := importSSHConfig(file)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"Include other.conf in a conditional section is skipped (" + file + ")",
+	}, warnings)
+	assert.Equal(t, `-- Imported from `+file+` by xs import
+-- WARNING: Include other.conf in a conditional section is skipped (`+file+`)
+
+host "*" {
+  ssh_config = {
+    User = "globaluser",
+  },
+}
+
+host "web1" {
+  ssh_config = {
+    HostName = "10.0.0.%h",
+    IdentityFile = { "~/.ssh/id_web", "~/.ssh/id_extra" },
+    SetEnv = "FOO=\"a b\"",
+  },
+}
+
+host "web2" {
+  ssh_config = {
+    HostName = "10.0.0.%h",
+    IdentityFile = "~/.ssh/id_web",
+  },
+}
+
+host "web*" {
+  ssh_config = {
+    Port = "2222",
+    User = "webuser",
+  },
+}
+
+host "db1" {
+  ssh_config = {
+    Port = "5432",
+  },
+}
+
+host "match-1" {
+  match = "host db1",
+  ssh_config = {
+    ForwardAgent = "yes",
+  },
+}
+
+host "web* (2)" {
+  match = "originalhost web*",
+  ssh_config = {
+    Compression = "yes",
+  },
+}
+`, lua)
+}
+
+func TestImportSSHConfigIncludes(t *testing.T) {
+	dir := t.TempDir()
+	included := filepath.Join(dir, "included.conf")
+	file := filepath.Join(dir, "config")
+	require.NoError(t, os.WriteFile(included, []byte("Host inc1\n  HostName inc.example.com\n"), 0644))
+	require.NoError(t, os.WriteFile(file, []byte("Port 2222\nInclude "+included+"\nUser deploy\nHost inc1\n  User inc\n"), 0644))
+
+	im := &sshConfigImporter{}
+	global := &sshConfigSection{Host: "*"}
+	im.sections = append(im.sections, global)
+	_, err := im.parseFile(file, global, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, []*importedHost{
+		{Name: "*", Params: []*sshConfigParam{{Keyword: "Port", Value: "2222"}}},
+		{Name: "inc1", Params: []*sshConfigParam{{Keyword: "HostName", Value: "inc.example.com"}}},
+		{Name: "* (2)", Match: "originalhost *", Params: []*sshConfigParam{{Keyword: "User", Value: "deploy"}}},
+	}, im.hosts())
+}
+
+func TestImportSSHConfigRoundTrip(t *testing.T) {
+	if _, err := exec.LookPath("ssh"); err != nil {
+		t.Skip("ssh is not available")
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config")
+	require.NoError(t, os.WriteFile(file, []byte(testImportSSHConfig), 0644))
+
+	lua, _, err := importSSHConfig(file)
+	require.NoError(t, err)
+
+	L := newLState()
+	defer L.Close()
+	require.NoError(t, L.DoString(lua))
+	cfg := getConfigFromLState(L)
+	require.NoError(t, cfg.resolveHostTemplates())
+
+	sshConfig, err := genSSHConfig(cfg)
+	require.NoError(t, err)
+	generated := filepath.Join(dir, "generated")
+	require.NoError(t, os.WriteFile(generated, sshConfig, 0644))
+
+	for _, hostname := range []string{"web1", "web2", "web3", "db1", "other"} {
+		expected, err := runSSHG(file, hostname)
+		require.NoError(t, err)
+		actual, err := runSSHG(generated, hostname)
+		require.NoError(t, err)
+		assert.Equal(t, string(expected), string(actual), hostname)
+	}
+}
+
+func TestLuaTableKey(t *testing.T) {
+	assert.Equal(t, "HostName", luaTableKey("HostName"))
+	assert.Equal(t, "_x1", luaTableKey("_x1"))
+	assert.Equal(t, `["1x"]`, luaTableKey("1x"))
+	assert.Equal(t, `["end"]`, luaTableKey("end"))
+	assert.Equal(t, `["a-b"]`, luaTableKey("a-b"))
+}
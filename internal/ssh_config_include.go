@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/yuin/gopher-lua"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxSSHConfigIncludeDepth is the limit of the nested Include directives, which is the same as OpenSSH.
+const maxSSHConfigIncludeDepth = 16
+
+// xsIncludeSSHConfigFunc includes existing ssh_config files like `include_ssh_config "~/.ssh/config"`.
+// The generated ssh_config includes the files by the Include directive after the hosts defined in Lua,
+// and the hosts in the files are imported into XS so that they are listed by "xs list".
+// If the path is omitted, "~/.ssh/config" is included.
+func xsIncludeSSHConfigFunc(L *lua.LState) int {
+	path := L.OptString(1, "~/.ssh/config")
+	cfg := getConfigFromLState(L)
+	path = resolveSSHConfigPath(path)
+
+	if !strings.ContainsAny(path, "*?[") {
+		if _, err := os.Stat(path); err != nil {
+			cfg.addIssue(luaCallerPos(L), "ssh_config file to include does not exist: %s", path)
+		}
+	}
+	cfg.SSHConfigIncludes = append(cfg.SSHConfigIncludes, path)
+	return 0
+}
+
+// resolveSSHConfigPath returns the absolute path of the ssh_config file.
+// Like the Include directive of OpenSSH, "~" is expanded to the home directory,
+// and a relative path is resolved from the "~/.ssh" directory.
+func resolveSSHConfigPath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return filepath.Join(userHomeDir(), path[1:])
+	}
+	if !filepath.IsAbs(path) {
+		return filepath.Join(userHomeDir(), ".ssh", path)
+	}
+	return path
+}
+
+// importSSHConfigHosts imports the hosts in the included ssh_config files.
+// The hosts already defined in Lua are not imported, because the hosts in Lua take precedence in the generated ssh_config.
+func (cfg *Config) importSSHConfigHosts() error {
+	for _, include := range cfg.SSHConfigIncludes {
+		hosts, err := parseSSHConfigFiles(include, 0)
+		if err != nil {
+			return err
+		}
+		for _, h := range hosts {
+			if cfg.NewHostFilter().GetHostByName(h.Name) != nil {
+				continue
+			}
+			cfg.Hosts = append(cfg.Hosts, h)
+		}
+	}
+	return nil
+}
+
+// parseSSHConfigFiles parses the ssh_config files matched by the glob pattern.
+func parseSSHConfigFiles(pattern string, depth int) ([]*Host, error) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ssh_config file path %s: %w", pattern, err)
+	}
+	hosts := make([]*Host, 0)
+	for _, file := range files {
+		fileHosts, err := parseSSHConfigFile(file, depth)
+		if err != nil {
+			return nil, err
+		}
+		hosts = mergeImportedHosts(hosts, fileHosts)
+	}
+	return hosts, nil
+}
+
+// parseSSHConfigFile parses the "Host" sections in the ssh_config file into hosts.
+// Each name in a "Host" line becomes a host, and negated patterns are ignored. "Match" sections are skipped.
+// If a host appears in multiple sections, the first obtained value for each parameter is used like ssh.
+// Include directives are followed only if they apply to all hosts, because the hosts in the conditionally
+// included files can not be resolved in general.
+func parseSSHConfigFile(file string, depth int) ([]*Host, error) {
+	if depth > maxSSHConfigIncludeDepth {
+		return nil, fmt.Errorf("too many nested Include directives in %s", file)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	hosts := make([]*Host, 0)
+	// current is the hosts of the current section. It is nil in "Match" sections.
+	current := make([]*Host, 0)
+	// conditional is true in the sections that do not apply to all hosts.
+	conditional := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		keyword, value := parseSSHConfigLine(scanner.Text())
+		if keyword == "" {
+			continue
+		}
+
+		switch strings.ToLower(keyword) {
+		case "host":
+			conditional = value != "*"
+			current = make([]*Host, 0)
+			for _, name := range strings.Fields(value) {
+				name = strings.Trim(name, `"`)
+				if name == "" || strings.HasPrefix(name, "!") {
+					continue
+				}
+				current = append(current, &Host{
+					Name:         name,
+					SSHConfig:    map[string]string{},
+					ImportedFrom: file,
+				})
+			}
+			hosts = mergeImportedHosts(hosts, current)
+			// refer to the merged hosts to add the parameters to them
+			for i, h := range current {
+				for _, merged := range hosts {
+					if merged.Name == h.Name {
+						current[i] = merged
+					}
+				}
+			}
+		case "match":
+			conditional = !strings.EqualFold(value, "all")
+			current = nil
+		case "include":
+			if conditional {
+				continue
+			}
+			for _, path := range strings.Fields(value) {
+				included, err := parseSSHConfigFiles(resolveSSHConfigPath(strings.Trim(path, `"`)), depth+1)
+				if err != nil {
+					return nil, err
+				}
+				hosts = mergeImportedHosts(hosts, included)
+			}
+		default:
+			for _, h := range current {
+				if h.sshConfigValue(keyword) == "" {
+					h.SSHConfig[keyword] = value
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// parseSSHConfigLine splits a line of ssh_config into the keyword and the value.
+// The keyword and the value are separated by whitespace or "=". Empty lines and comments return an empty keyword.
+func parseSSHConfigLine(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", ""
+	}
+	i := strings.IndexAny(line, " \t=")
+	if i < 0 {
+		return line, ""
+	}
+	keyword := line[:i]
+	value := strings.TrimSpace(line[i:])
+	value = strings.TrimSpace(strings.TrimPrefix(value, "="))
+	return keyword, value
+}
+
+// mergeImportedHosts appends the hosts that are not in the list yet.
+// The parameters of a host that is already in the list are merged into it, keeping the existing values.
+func mergeImportedHosts(hosts []*Host, others []*Host) []*Host {
+	for _, o := range others {
+		var existing *Host
+		for _, h := range hosts {
+			if h.Name == o.Name {
+				existing = h
+				break
+			}
+		}
+		if existing == nil {
+			hosts = append(hosts, o)
+			continue
+		}
+		for k, v := range o.SSHConfig {
+			if existing.sshConfigValue(k) == "" {
+				existing.SSHConfig[k] = v
+			}
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSSHConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "conf.d"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "config"), []byte(`# comment
+Include `+filepath.Join(dir, "conf.d", "*")+`
+
+Host legacy1 legacy2
+    HostName 10.0.0.1
+    User admin
+
+Host *.corp !bad.corp
+    User corp
+
+Match host foo
+    User matched
+    Include `+filepath.Join(dir, "conditional")+`
+`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "conf.d", "extra"), []byte(`Host extra
+  HostName=10.0.0.5
+  Port = 2200
+Host legacy1
+  User other
+`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "conditional"), []byte(`Host conditional
+  HostName 10.0.0.6
+`), 0644))
+
+	hosts, err := parseSSHConfigFile(filepath.Join(dir, "config"), 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"extra", "legacy1", "legacy2", "*.corp"}, hostNames(hosts))
+	assert.Equal(t, map[string]string{"HostName": "10.0.0.5", "Port": "2200"}, hosts[0].SSHConfig)
+	assert.Equal(t, filepath.Join(dir, "conf.d", "extra"), hosts[0].ImportedFrom)
+	assert.Equal(t, map[string]string{"HostName": "10.0.0.1", "User": "other"}, hosts[1].SSHConfig)
+	assert.Equal(t, map[string]string{"HostName": "10.0.0.1", "User": "admin"}, hosts[2].SSHConfig)
+	assert.Equal(t, filepath.Join(dir, "config"), hosts[2].ImportedFrom)
+	assert.True(t, hosts[3].IsPattern())
+}
+
+func TestParseSSHConfigFile_RecursiveInclude(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(file, []byte("Include "+file+"\n"), 0644))
+
+	_, err := parseSSHConfigFile(file, 0)
+	assert.ErrorContains(t, err, "too many nested Include directives")
+}
+
+func TestIncludeSSHConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(file, []byte(`Host web1
+    HostName 10.9.9.9
+Host legacy
+    HostName 10.0.0.1
+`), 0644))
+
+	L := newLState()
+	defer L.Close()
+	err := L.DoString(`
+host "web1" {
+  ssh_config = { HostName = "192.168.0.1" },
+}
+include_ssh_config "` + file + `"
+`)
+	require.NoError(t, err)
+
+	cfg := getConfigFromLState(L)
+	require.NoError(t, cfg.importSSHConfigHosts())
+	assert.Equal(t, []string{"web1", "legacy"}, hostNames(cfg.Hosts))
+	assert.Equal(t, "192.168.0.1", cfg.Hosts[0].SSHConfig["HostName"])
+	assert.Equal(t, file, cfg.Hosts[1].ImportedFrom)
+
+	b, err := genSSHConfig(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, `# The configuration is generated by xs with the config file: 
+
+Host web1
+    HostName 192.168.0.1
+
+Match all
+    Include `+file+`
+
+`, string(b))
+}
+
+func TestParseSSHConfigLine(t *testing.T) {
+	testCases := []struct {
+		line    string
+		keyword string
+		value   string
+	}{
+		{line: "HostName example.com", keyword: "HostName", value: "example.com"},
+		{line: "  Port=22", keyword: "Port", value: "22"},
+		{line: "User = admin", keyword: "User", value: "admin"},
+		{line: "\tLocalForward 8080 localhost:80", keyword: "LocalForward", value: "8080 localhost:80"},
+		{line: "# comment", keyword: "", value: ""},
+		{line: "", keyword: "", value: ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.line, func(t *testing.T) {
+			keyword, value := parseSSHConfigLine(tc.line)
+			assert.Equal(t, tc.keyword, keyword)
+			assert.Equal(t, tc.value, value)
+		})
+	}
+}
@@ -1,8 +1,14 @@
 package internal
 
 import (
+	"github.com/kohkimakimoto/xs/internal/debuglogger"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestGenSSHConfig(t *testing.T) {
@@ -45,3 +51,175 @@ Host host2
 	// t.Logf("ssh config:\n%s", string(b))
 
 }
+
+func TestGenSSHConfig_PatternHosts(t *testing.T) {
+	cfg := &Config{
+		Filepath: "path/to/config",
+		Hosts: []*Host{
+			{
+				Name: "*",
+				SSHConfig: map[string]string{
+					"ServerAliveInterval": "60",
+				},
+			},
+			{
+				Name: "*.internal",
+				SSHConfig: map[string]string{
+					"ProxyJump": "bastion",
+				},
+			},
+			{
+				Name:  "corp",
+				Match: `host *.corp exec "test -f ~/.corp"`,
+				SSHConfig: map[string]string{
+					"User": "corp-user",
+				},
+			},
+			{
+				Name: "host1",
+				SSHConfig: map[string]string{
+					"HostName": "host1.internal",
+				},
+			},
+		},
+	}
+	b, err := genSSHConfig(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, `# The configuration is generated by xs with the config file: path/to/config
+
+Host host1
+    HostName host1.internal
+
+Host *
+    ServerAliveInterval 60
+
+Host *.internal
+    ProxyJump bastion
+
+Match host *.corp exec "test -f ~/.corp"
+    User corp-user
+
+`, string(b))
+}
+
+func TestGenSSHConfig_Includes(t *testing.T) {
+	cfg := &Config{
+		Filepath: "path/to/config",
+		Hosts: []*Host{
+			{
+				Name: "*",
+				SSHConfig: map[string]string{
+					"User": "default-user",
+				},
+			},
+			{
+				Name: "host1",
+				SSHConfig: map[string]string{
+					"HostName": "host1.example.com",
+				},
+			},
+			{
+				Name:         "legacy",
+				ImportedFrom: "/home/user/.ssh/config",
+				SSHConfig: map[string]string{
+					"User": "legacy-user",
+				},
+			},
+		},
+		SSHConfigIncludes: []string{"/home/user/.ssh/config", "/home/user/.ssh/conf d/*"},
+	}
+	b, err := genSSHConfig(cfg)
+	assert.NoError(t, err)
+	// The included files are placed between the concrete hosts and the pattern hosts.
+	assert.Equal(t, `# The configuration is generated by xs with the config file: path/to/config
+
+Host host1
+    HostName host1.example.com
+
+Match all
+    Include /home/user/.ssh/config
+    Include "/home/user/.ssh/conf d/*"
+
+Host *
+    User default-user
+
+`, string(b))
+
+	// The native ssh client resolves the parameters in the same order.
+	assert.Equal(t, "legacy-user", effectiveSSHConfig(cfg, "legacy")["user"])
+	assert.Equal(t, "default-user", effectiveSSHConfig(cfg, "host1")["user"])
+}
+
+func TestWriteSSHConfigFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cfg := &Config{
+		Filepath:    "path/to/config",
+		DebugLogger: debuglogger.New(io.Discard, false, true),
+		Hosts: []*Host{
+			{Name: "host1", SSHConfig: map[string]string{"HostName": "host1.example.com"}},
+		},
+	}
+
+	t.Run("temporary file", func(t *testing.T) {
+		file, remove, err := writeSSHConfigFile(cfg)
+		require.NoError(t, err)
+		info, err := os.Stat(file)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+		remove()
+		_, err = os.Stat(file)
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("stable file", func(t *testing.T) {
+		cfg.StableSSHConfig = true
+		defer func() { cfg.StableSSHConfig = false }()
+
+		file, remove, err := writeSSHConfigFile(cfg)
+		require.NoError(t, err)
+		remove()
+		assert.Equal(t, getSSHConfigDir(), filepath.Dir(file))
+		info, err := os.Stat(file)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+		expected, err := genSSHConfig(cfg)
+		require.NoError(t, err)
+		actual, err := os.ReadFile(file)
+		require.NoError(t, err)
+		assert.Equal(t, string(expected), string(actual))
+
+		// The same content is written to the same path.
+		same, _, err := writeSSHConfigFile(cfg)
+		require.NoError(t, err)
+		assert.Equal(t, file, same)
+
+		// The different content is written to another path.
+		cfg.Hosts[0].SSHConfig["Port"] = "2222"
+		defer delete(cfg.Hosts[0].SSHConfig, "Port")
+		other, _, err := writeSSHConfigFile(cfg)
+		require.NoError(t, err)
+		assert.NotEqual(t, file, other)
+		_, err = os.Stat(file)
+		assert.NoError(t, err)
+	})
+}
+
+func TestPruneStableSSHConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	current := filepath.Join(dir, "ssh_config.current")
+	recent := filepath.Join(dir, "ssh_config.recent")
+	old := filepath.Join(dir, "ssh_config.old")
+	for _, file := range []string{current, recent, old} {
+		require.NoError(t, os.WriteFile(file, []byte("Host *\n"), 0600))
+	}
+	expired := time.Now().Add(-stableSSHConfigExpiration - time.Hour)
+	require.NoError(t, os.Chtimes(old, expired, expired))
+	require.NoError(t, os.Chtimes(current, expired, expired))
+
+	pruneStableSSHConfigFiles(dir, current)
+
+	assert.FileExists(t, current)
+	assert.FileExists(t, recent)
+	assert.NoFileExists(t, old)
+}
@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"strings"
+)
+
+// sshConfigKeywords is the list of the keywords that OpenSSH ssh_config accepts.
+// It includes the deprecated and platform-specific keywords, which OpenSSH still recognizes.
+var sshConfigKeywords = []string{
+	// keywords
+	"AddKeysToAgent",
+	"AddressFamily",
+	"BatchMode",
+	"BindAddress",
+	"BindInterface",
+	"CanonicalDomains",
+	"CanonicalizeFallbackLocal",
+	"CanonicalizeHostname",
+	"CanonicalizeMaxDots",
+	"CanonicalizePermittedCNAMEs",
+	"CASignatureAlgorithms",
+	"CertificateFile",
+	"ChannelTimeout",
+	"CheckHostIP",
+	"Ciphers",
+	"ClearAllForwardings",
+	"Compression",
+	"ConnectionAttempts",
+	"ConnectTimeout",
+	"ControlMaster",
+	"ControlPath",
+	"ControlPersist",
+	"DynamicForward",
+	"EnableEscapeCommandline",
+	"EnableSSHKeysign",
+	"EscapeChar",
+	"ExitOnForwardFailure",
+	"FingerprintHash",
+	"ForkAfterAuthentication",
+	"ForwardAgent",
+	"ForwardX11",
+	"ForwardX11Timeout",
+	"ForwardX11Trusted",
+	"GatewayPorts",
+	"GlobalKnownHostsFile",
+	"GSSAPIAuthentication",
+	"GSSAPIClientIdentity",
+	"GSSAPIDelegateCredentials",
+	"GSSAPIKexAlgorithms",
+	"GSSAPIKeyExchange",
+	"GSSAPIRenewalForcesRekey",
+	"GSSAPIServerIdentity",
+	"GSSAPITrustDns",
+	"HashKnownHosts",
+	"Host",
+	"HostbasedAcceptedAlgorithms",
+	"HostbasedAuthentication",
+	"HostKeyAlgorithms",
+	"HostKeyAlias",
+	"HostName",
+	"IdentitiesOnly",
+	"IdentityAgent",
+	"IdentityFile",
+	"IgnoreUnknown",
+	"Include",
+	"IPQoS",
+	"KbdInteractiveAuthentication",
+	"KbdInteractiveDevices",
+	"KexAlgorithms",
+	"KnownHostsCommand",
+	"LocalCommand",
+	"LocalForward",
+	"LogLevel",
+	"LogVerbose",
+	"MACs",
+	"Match",
+	"NoHostAuthenticationForLocalhost",
+	"NumberOfPasswordPrompts",
+	"ObscureKeystrokeTiming",
+	"PasswordAuthentication",
+	"PermitLocalCommand",
+	"PermitRemoteOpen",
+	"PKCS11Provider",
+	"Port",
+	"PreferredAuthentications",
+	"ProxyCommand",
+	"ProxyJump",
+	"ProxyUseFdpass",
+	"PubkeyAcceptedAlgorithms",
+	"PubkeyAuthentication",
+	"RekeyLimit",
+	"RemoteCommand",
+	"RemoteForward",
+	"RequestTTY",
+	"RequiredRSASize",
+	"RevokedHostKeys",
+	"SecurityKeyProvider",
+	"SendEnv",
+	"ServerAliveCountMax",
+	"ServerAliveInterval",
+	"SessionType",
+	"SetEnv",
+	"StdinNull",
+	"StreamLocalBindMask",
+	"StreamLocalBindUnlink",
+	"StrictHostKeyChecking",
+	"SyslogFacility",
+	"Tag",
+	"TCPKeepAlive",
+	"Tunnel",
+	"TunnelDevice",
+	"UpdateHostKeys",
+	"User",
+	"UserKnownHostsFile",
+	"VerifyHostKeyDNS",
+	"VisualHostKey",
+	"WarnWeakCrypto",
+	"XAuthLocation",
+	// deprecated, aliases or platform-specific keywords
+	"ChallengeResponseAuthentication",
+	"Cipher",
+	"CompressionLevel",
+	"DSAAuthentication",
+	"FallBackToRsh",
+	"HostbasedKeyTypes",
+	"KeepAlive",
+	"Protocol",
+	"PubkeyAcceptedKeyTypes",
+	"RhostsAuthentication",
+	"RhostsRSAAuthentication",
+	"RSAAuthentication",
+	"SmartcardDevice",
+	"UseKeychain",
+	"UsePrivilegedPort",
+	"UseRoaming",
+	"UseRsh",
+}
+
+// lookupSSHConfigKeyword returns the canonical form of the keyword.
+// ssh_config keywords are case-insensitive.
+func lookupSSHConfigKeyword(key string) (string, bool) {
+	for _, keyword := range sshConfigKeywords {
+		if strings.EqualFold(keyword, key) {
+			return keyword, true
+		}
+	}
+	return "", false
+}
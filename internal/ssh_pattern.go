@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"strings"
+)
+
+// isSSHPattern reports whether the host name is an ssh_config pattern like "*.example.com" or "!bastion *".
+func isSSHPattern(name string) bool {
+	return strings.ContainsAny(name, "*?!, \t")
+}
+
+// matchSSHPatternList reports whether the hostname matches the pattern list in the same way as OpenSSH does.
+// The patterns are separated by whitespace or commas. A pattern prefixed with "!" is negated.
+// The hostname matches when it matches at least one pattern and does not match any negated pattern.
+func matchSSHPatternList(patterns string, hostname string) bool {
+	matched := false
+	for _, pattern := range strings.FieldsFunc(patterns, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	}) {
+		if negated, ok := strings.CutPrefix(pattern, "!"); ok {
+			if matchSSHPattern(negated, hostname) {
+				return false
+			}
+		} else if matchSSHPattern(pattern, hostname) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// matchSSHPattern matches the hostname against a single pattern that supports "*" and "?" wildcards.
+// The match is case-insensitive like OpenSSH host matching.
+func matchSSHPattern(pattern string, hostname string) bool {
+	pattern = strings.ToLower(pattern)
+	hostname = strings.ToLower(hostname)
+
+	// iterative wildcard matching with backtracking on the last "*"
+	p, s := 0, 0
+	star, mark := -1, 0
+	for s < len(hostname) {
+		if p < len(pattern) && (pattern[p] == '?' || pattern[p] == hostname[s]) {
+			p++
+			s++
+		} else if p < len(pattern) && pattern[p] == '*' {
+			star = p
+			mark = s
+			p++
+		} else if star >= 0 {
+			p = star + 1
+			mark++
+			s = mark
+		} else {
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
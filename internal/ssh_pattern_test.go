@@ -0,0 +1,32 @@
+package internal
+
+import "testing"
+
+func TestMatchSSHPatternList(t *testing.T) {
+	testCases := []struct {
+		patterns string
+		hostname string
+		expected bool
+	}{
+		{patterns: "*", hostname: "web1", expected: true},
+		{patterns: "*.internal", hostname: "web1.internal", expected: true},
+		{patterns: "*.internal", hostname: "web1.example.com", expected: false},
+		{patterns: "web?", hostname: "web1", expected: true},
+		{patterns: "web?", hostname: "web10", expected: false},
+		{patterns: "WEB*", hostname: "web1", expected: true},
+		{patterns: "web* db*", hostname: "db1", expected: true},
+		{patterns: "web*,db*", hostname: "db1", expected: true},
+		{patterns: "* !bastion", hostname: "bastion", expected: false},
+		{patterns: "* !bastion", hostname: "web1", expected: true},
+		{patterns: "!bastion", hostname: "web1", expected: false},
+		{patterns: "a*b*c", hostname: "aXbYbZc", expected: true},
+		{patterns: "a*b*c", hostname: "aXbYbZ", expected: false},
+	}
+
+	for _, testCase := range testCases {
+		actual := matchSSHPatternList(testCase.patterns, testCase.hostname)
+		if actual != testCase.expected {
+			t.Errorf("unexpected result for %q and %q. expected: %t, but got: %t", testCase.patterns, testCase.hostname, testCase.expected, actual)
+		}
+	}
+}
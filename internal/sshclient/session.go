@@ -0,0 +1,83 @@
+package sshclient
+
+import (
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/term"
+	"io"
+	"os"
+)
+
+// RunOptions is the options to run a session.
+type RunOptions struct {
+	// Command is the remote command. If it is empty, the login shell is started.
+	Command string
+	// TTY requests a pseudo terminal.
+	TTY    bool
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Run runs a session on the client.
+// If the remote command exits with a non-zero status, it returns *ssh.ExitError.
+func Run(client *ssh.Client, cfg *Config, opts *RunOptions) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = session.Close() }()
+
+	session.Stdin = opts.Stdin
+	session.Stdout = opts.Stdout
+	session.Stderr = opts.Stderr
+
+	if cfg.ForwardAgent {
+		if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+			if err := agent.ForwardToRemote(client, sock); err != nil {
+				return err
+			}
+			if err := agent.RequestAgentForwarding(session); err != nil {
+				return err
+			}
+		}
+	}
+
+	if opts.TTY {
+		width, height := 80, 24
+		if f, ok := opts.Stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+			fd := int(f.Fd())
+			if w, h, err := term.GetSize(fd); err == nil {
+				width, height = w, h
+			}
+			state, err := term.MakeRaw(fd)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = term.Restore(fd, state) }()
+
+			stop := watchWindowSize(fd, session)
+			defer stop()
+		}
+
+		termType := os.Getenv("TERM")
+		if termType == "" {
+			termType = "xterm"
+		}
+		if err := session.RequestPty(termType, height, width, ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}); err != nil {
+			return err
+		}
+	}
+
+	if opts.Command == "" {
+		if err := session.Shell(); err != nil {
+			return err
+		}
+		return session.Wait()
+	}
+	return session.Run(opts.Command)
+}
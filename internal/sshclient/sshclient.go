@@ -0,0 +1,274 @@
+// Package sshclient implements a minimal SSH client based on golang.org/x/crypto/ssh.
+// It is used as an alternative to the OpenSSH ssh command, so that xs works in environments without OpenSSH.
+package sshclient
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Config is the connection settings of a host.
+// It corresponds to the subset of ssh_config parameters that the client understands.
+type Config struct {
+	HostName              string
+	Port                  string
+	User                  string
+	IdentityFiles         []string
+	ForwardAgent          bool
+	StrictHostKeyChecking string
+	UserKnownHostsFiles   []string
+	ConnectTimeout        time.Duration
+	// ProxyJump is the list of the jump hosts to connect through in order.
+	ProxyJump []*Config
+}
+
+func (c *Config) Addr() string {
+	port := c.Port
+	if port == "" {
+		port = "22"
+	}
+	return net.JoinHostPort(c.HostName, port)
+}
+
+// Dial connects to the host through the jump hosts if any.
+func Dial(cfg *Config) (*ssh.Client, error) {
+	var client *ssh.Client
+	for _, c := range append(append([]*Config{}, cfg.ProxyJump...), cfg) {
+		next, err := dialVia(client, c)
+		if err != nil {
+			if client != nil {
+				_ = client.Close()
+			}
+			return nil, err
+		}
+		client = next
+	}
+	return client, nil
+}
+
+// dialVia connects to the host. If the jump client is not nil, it connects through the jump client.
+func dialVia(jump *ssh.Client, cfg *Config) (*ssh.Client, error) {
+	clientConfig, knownHostsCallback, err := newClientConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := cfg.Addr()
+	var conn net.Conn
+	if jump == nil {
+		conn, err = net.DialTimeout("tcp", addr, cfg.ConnectTimeout)
+	} else {
+		conn, err = jump.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	clientConfig.HostKeyAlgorithms = knownHostKeyAlgorithms(knownHostsCallback, addr, conn.RemoteAddr())
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, clientConfig)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to establish ssh connection to %s: %w", addr, err)
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// newClientConfig returns the config of the ssh client and the callback of the known_hosts files.
+// The callback of the known_hosts files is nil if there are no known_hosts files or the host keys are not checked.
+func newClientConfig(cfg *Config) (*ssh.ClientConfig, ssh.HostKeyCallback, error) {
+	hostKeyCallback, knownHostsCallback, err := newHostKeyCallback(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeysCallback(signersCallback(cfg))},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         cfg.ConnectTimeout,
+	}, knownHostsCallback, nil
+}
+
+// signersCallback returns the signers from the ssh agent and the identity files.
+// Identity files protected by a passphrase are skipped. Load them into the ssh agent to use them.
+func signersCallback(cfg *Config) func() ([]ssh.Signer, error) {
+	return func() ([]ssh.Signer, error) {
+		signers := make([]ssh.Signer, 0)
+		if a, closer, err := newAgentClient(); err == nil {
+			defer func() { _ = closer() }()
+			if agentSigners, err := a.Signers(); err == nil {
+				signers = append(signers, agentSigners...)
+			}
+		}
+
+		identityFiles := cfg.IdentityFiles
+		if len(identityFiles) == 0 {
+			identityFiles = defaultIdentityFiles()
+		}
+		for _, file := range identityFiles {
+			b, err := os.ReadFile(ExpandHome(file))
+			if err != nil {
+				continue
+			}
+			signer, err := ssh.ParsePrivateKey(b)
+			if err != nil {
+				continue
+			}
+			signers = append(signers, signer)
+		}
+		if len(signers) == 0 {
+			return nil, errors.New("no available identities")
+		}
+		return signers, nil
+	}
+}
+
+func defaultIdentityFiles() []string {
+	return []string{
+		"~/.ssh/id_ed25519",
+		"~/.ssh/id_ecdsa",
+		"~/.ssh/id_rsa",
+	}
+}
+
+func newAgentClient() (agent.ExtendedAgent, func() error, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, nil, errors.New("SSH_AUTH_SOCK is not set")
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, nil, err
+	}
+	return agent.NewClient(conn), conn.Close, nil
+}
+
+// newHostKeyCallback returns the callback to verify host keys by the known_hosts files.
+// It behaves like OpenSSH according to the StrictHostKeyChecking value:
+//   - "no" or "off": any host keys are accepted.
+//   - "accept-new": unknown host keys are added to the first known_hosts file, but changed host keys are rejected.
+//   - otherwise: unknown and changed host keys are rejected.
+//
+// It also returns the callback of the known_hosts files as is, or nil if there are no known_hosts files.
+func newHostKeyCallback(cfg *Config) (ssh.HostKeyCallback, ssh.HostKeyCallback, error) {
+	mode := strings.ToLower(cfg.StrictHostKeyChecking)
+	if mode == "no" || mode == "off" {
+		return ssh.InsecureIgnoreHostKey(), nil, nil
+	}
+
+	files := make([]string, 0, len(cfg.UserKnownHostsFiles))
+	for _, file := range cfg.UserKnownHostsFiles {
+		files = append(files, ExpandHome(file))
+	}
+	if len(files) == 0 {
+		files = append(files, ExpandHome("~/.ssh/known_hosts"))
+	}
+	existingFiles := make([]string, 0, len(files))
+	for _, file := range files {
+		if _, err := os.Stat(file); err == nil {
+			existingFiles = append(existingFiles, file)
+		}
+	}
+
+	var callback ssh.HostKeyCallback
+	if len(existingFiles) > 0 {
+		var err error
+		if callback, err = knownhosts.New(existingFiles...); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if callback != nil {
+			err := callback(hostname, remote, key)
+			var keyErr *knownhosts.KeyError
+			if err == nil || !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+				// known host, or the host key has been changed.
+				return err
+			}
+		}
+		// unknown host
+		if mode != "accept-new" {
+			return fmt.Errorf("host key verification failed: no host key is known for %s", hostname)
+		}
+		return appendKnownHost(files[0], hostname, key)
+	}, callback, nil
+}
+
+// knownHostKeyAlgorithms returns the host key algorithms of the keys recorded for the host in the known_hosts files,
+// so that the server does not choose a host key of another type, which would be rejected as a changed key.
+// It returns nil to use the default algorithms if no keys are recorded.
+func knownHostKeyAlgorithms(callback ssh.HostKeyCallback, hostname string, remote net.Addr) []string {
+	if callback == nil {
+		return nil
+	}
+	// As the knownhosts package documents, a key that is not in the files makes the callback return
+	// all the keys recorded for the host.
+	var keyErr *knownhosts.KeyError
+	if err := callback(hostname, remote, unknownPublicKey{}); !errors.As(err, &keyErr) {
+		return nil
+	}
+
+	algorithms := make([]string, 0)
+	for _, known := range keyErr.Want {
+		for _, algo := range hostKeyAlgorithmsOf(known.Key.Type()) {
+			if !slices.Contains(algorithms, algo) {
+				algorithms = append(algorithms, algo)
+			}
+		}
+	}
+	if len(algorithms) == 0 {
+		return nil
+	}
+	return algorithms
+}
+
+// hostKeyAlgorithmsOf returns the host key algorithms that can be used with the key type.
+func hostKeyAlgorithmsOf(keyType string) []string {
+	switch keyType {
+	case ssh.KeyAlgoRSA:
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	case ssh.CertAlgoRSAv01:
+		return []string{ssh.CertAlgoRSASHA512v01, ssh.CertAlgoRSASHA256v01, ssh.CertAlgoRSAv01}
+	default:
+		return []string{keyType}
+	}
+}
+
+// unknownPublicKey is the public key that never matches the keys in the known_hosts files.
+type unknownPublicKey struct{}
+
+func (unknownPublicKey) Type() string                            { return "xs-unknown" }
+func (unknownPublicKey) Marshal() []byte                         { return []byte{} }
+func (unknownPublicKey) Verify(_ []byte, _ *ssh.Signature) error { return errors.New("unknown key") }
+
+func appendKnownHost(file string, hostname string, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	_, err = fmt.Fprintln(f, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key))
+	return err
+}
+
+// ExpandHome expands the leading "~" of the path to the user's home directory.
+func ExpandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
@@ -0,0 +1,348 @@
+package sshclient
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testServer is an in-process ssh server for testing.
+// It runs "exec" requests by echoing the command, and "exit <n>" exits with the status n.
+// It also supports "direct-tcpip" channels to be used as a jump host.
+type testServer struct {
+	listener net.Listener
+	hostKey  ssh.Signer
+	mu       sync.Mutex
+	users    []string
+}
+
+// The server has an ed25519 host key and the extra host keys if any.
+func newTestServer(t *testing.T, authorizedKey ssh.PublicKey, extraHostKeys ...ssh.Signer) *testServer {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostKey, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), authorizedKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unauthorized")
+		},
+	}
+	config.AddHostKey(hostKey)
+	for _, k := range extraHostKeys {
+		config.AddHostKey(k)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &testServer{listener: listener, hostKey: hostKey}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.handleConn(conn, config)
+		}
+	}()
+	return s
+}
+
+func (s *testServer) Port() string {
+	return strconv.Itoa(s.listener.Addr().(*net.TCPAddr).Port)
+}
+
+func (s *testServer) handleConn(conn net.Conn, config *ssh.ServerConfig) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.users = append(s.users, sconn.User())
+	s.mu.Unlock()
+
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		switch newChannel.ChannelType() {
+		case "session":
+			go handleSession(newChannel)
+		case "direct-tcpip":
+			go handleDirectTCPIP(newChannel)
+		default:
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+		}
+	}
+}
+
+func handleSession(newChannel ssh.NewChannel) {
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer func() { _ = channel.Close() }()
+
+	for req := range requests {
+		if req.Type != "exec" {
+			_ = req.Reply(req.Type == "pty-req", nil)
+			continue
+		}
+		var payload struct{ Command string }
+		_ = ssh.Unmarshal(req.Payload, &payload)
+		_ = req.Reply(true, nil)
+
+		status := 0
+		if code, ok := strings.CutPrefix(payload.Command, "exit "); ok {
+			status, _ = strconv.Atoi(code)
+		} else {
+			_, _ = io.WriteString(channel, "run: "+payload.Command+"\n")
+		}
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, uint32(status))
+		_, _ = channel.SendRequest("exit-status", false, b)
+		return
+	}
+}
+
+func handleDirectTCPIP(newChannel ssh.NewChannel) {
+	var payload struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &payload); err != nil {
+		_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	target, err := net.Dial("tcp", net.JoinHostPort(payload.Host, strconv.Itoa(int(payload.Port))))
+	if err != nil {
+		_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		_ = target.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	go func() {
+		_, _ = io.Copy(target, channel)
+		_ = target.Close()
+	}()
+	_, _ = io.Copy(channel, target)
+	_ = channel.Close()
+}
+
+// writeTestIdentity generates a client key and writes it to a file.
+func writeTestIdentity(t *testing.T) (string, ssh.PublicKey) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	require.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(file, pem.EncodeToMemory(block), 0600))
+
+	sshPub, err := ssh.NewPublicKey(pub)
+	require.NoError(t, err)
+	return file, sshPub
+}
+
+func TestRun(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	identityFile, pub := writeTestIdentity(t)
+	server := newTestServer(t, pub)
+
+	cfg := &Config{
+		HostName:              "127.0.0.1",
+		Port:                  server.Port(),
+		User:                  "testuser",
+		IdentityFiles:         []string{identityFile},
+		StrictHostKeyChecking: "no",
+	}
+
+	t.Run("run command", func(t *testing.T) {
+		client, err := Dial(cfg)
+		require.NoError(t, err)
+		defer func() { _ = client.Close() }()
+
+		var stdout bytes.Buffer
+		err = Run(client, cfg, &RunOptions{Command: "echo hello", Stdout: &stdout, Stderr: io.Discard})
+		assert.NoError(t, err)
+		assert.Equal(t, "run: echo hello\n", stdout.String())
+	})
+
+	t.Run("exit status", func(t *testing.T) {
+		client, err := Dial(cfg)
+		require.NoError(t, err)
+		defer func() { _ = client.Close() }()
+
+		err = Run(client, cfg, &RunOptions{Command: "exit 3", Stdout: io.Discard, Stderr: io.Discard})
+		var exitErr *ssh.ExitError
+		require.ErrorAs(t, err, &exitErr)
+		assert.Equal(t, 3, exitErr.ExitStatus())
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		otherIdentityFile, _ := writeTestIdentity(t)
+		_, err := Dial(&Config{
+			HostName:              "127.0.0.1",
+			Port:                  server.Port(),
+			User:                  "testuser",
+			IdentityFiles:         []string{otherIdentityFile},
+			StrictHostKeyChecking: "no",
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestDial_ProxyJump(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	identityFile, pub := writeTestIdentity(t)
+	jumpServer := newTestServer(t, pub)
+	server := newTestServer(t, pub)
+
+	cfg := &Config{
+		HostName:              "127.0.0.1",
+		Port:                  server.Port(),
+		User:                  "testuser",
+		IdentityFiles:         []string{identityFile},
+		StrictHostKeyChecking: "no",
+		ProxyJump: []*Config{
+			{
+				HostName:              "127.0.0.1",
+				Port:                  jumpServer.Port(),
+				User:                  "jumpuser",
+				IdentityFiles:         []string{identityFile},
+				StrictHostKeyChecking: "no",
+			},
+		},
+	}
+
+	client, err := Dial(cfg)
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	var stdout bytes.Buffer
+	err = Run(client, cfg, &RunOptions{Command: "hostname", Stdout: &stdout, Stderr: io.Discard})
+	assert.NoError(t, err)
+	assert.Equal(t, "run: hostname\n", stdout.String())
+	assert.Equal(t, []string{"jumpuser"}, jumpServer.users)
+	assert.Equal(t, []string{"testuser"}, server.users)
+}
+
+func TestDial_HostKeyChecking(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	identityFile, pub := writeTestIdentity(t)
+	server := newTestServer(t, pub)
+	knownHostsFile := filepath.Join(t.TempDir(), "known_hosts")
+
+	newConfig := func(mode string) *Config {
+		return &Config{
+			HostName:              "127.0.0.1",
+			Port:                  server.Port(),
+			User:                  "testuser",
+			IdentityFiles:         []string{identityFile},
+			StrictHostKeyChecking: mode,
+			UserKnownHostsFiles:   []string{knownHostsFile},
+		}
+	}
+
+	// unknown host is rejected
+	_, err := Dial(newConfig("yes"))
+	assert.ErrorContains(t, err, "host key verification failed")
+
+	// unknown host is added to the known_hosts file
+	client, err := Dial(newConfig("accept-new"))
+	require.NoError(t, err)
+	_ = client.Close()
+	b, err := os.ReadFile(knownHostsFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "[127.0.0.1]:"+server.Port())
+
+	// known host is accepted
+	client, err = Dial(newConfig("yes"))
+	require.NoError(t, err)
+	_ = client.Close()
+
+	// changed host key is rejected even if accept-new
+	other := newTestServer(t, pub)
+	require.NoError(t, os.WriteFile(knownHostsFile, bytes.ReplaceAll(b, []byte(server.Port()), []byte(other.Port())), 0600))
+	_, err = Dial(&Config{
+		HostName:              "127.0.0.1",
+		Port:                  other.Port(),
+		User:                  "testuser",
+		IdentityFiles:         []string{identityFile},
+		StrictHostKeyChecking: "accept-new",
+		UserKnownHostsFiles:   []string{knownHostsFile},
+	})
+	assert.Error(t, err)
+}
+
+func TestDial_HostKeyAlgorithms(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	identityFile, pub := writeTestIdentity(t)
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecdsaSigner, err := ssh.NewSignerFromKey(ecdsaKey)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaSigner, err := ssh.NewSignerFromKey(rsaKey)
+	require.NoError(t, err)
+
+	// The server prefers the ECDSA host key by default, but only the ed25519 host key is known.
+	server := newTestServer(t, pub, ecdsaSigner, rsaSigner)
+	knownHostsFile := filepath.Join(t.TempDir(), "known_hosts")
+	hostname := knownhosts.Normalize("127.0.0.1:" + server.Port())
+	require.NoError(t, os.WriteFile(knownHostsFile, []byte(knownhosts.Line([]string{hostname}, server.hostKey.PublicKey())+"\n"), 0600))
+
+	config := &Config{
+		HostName:              "127.0.0.1",
+		Port:                  server.Port(),
+		User:                  "testuser",
+		IdentityFiles:         []string{identityFile},
+		StrictHostKeyChecking: "yes",
+		UserKnownHostsFiles:   []string{knownHostsFile},
+	}
+	client, err := Dial(config)
+	require.NoError(t, err)
+	_ = client.Close()
+
+	// The RSA host key is negotiated by the rsa-sha2 algorithms.
+	require.NoError(t, os.WriteFile(knownHostsFile, []byte(knownhosts.Line([]string{hostname}, rsaSigner.PublicKey())+"\n"), 0600))
+	client, err = Dial(config)
+	require.NoError(t, err)
+	_ = client.Close()
+
+	callback, err := knownhosts.New(knownHostsFile)
+	require.NoError(t, err)
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 22}
+	assert.Equal(t, []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}, knownHostKeyAlgorithms(callback, "127.0.0.1:"+server.Port(), addr))
+	assert.Nil(t, knownHostKeyAlgorithms(callback, "unknown:22", addr))
+	assert.Nil(t, knownHostKeyAlgorithms(nil, "127.0.0.1:"+server.Port(), addr))
+}
@@ -0,0 +1,34 @@
+//go:build !windows
+
+package sshclient
+
+import (
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchWindowSize propagates the terminal size to the remote when the local terminal is resized.
+func watchWindowSize(fd int, session *ssh.Session) func() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGWINCH)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ch:
+				if w, h, err := term.GetSize(fd); err == nil {
+					_ = session.WindowChange(h, w)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build windows
+
+package sshclient
+
+import (
+	"golang.org/x/crypto/ssh"
+)
+
+// watchWindowSize does nothing on Windows because it has no SIGWINCH.
+func watchWindowSize(fd int, session *ssh.Session) func() {
+	return func() {}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/jedib0t/go-pretty/v6/text"
 	"io"
 	"regexp"
+	"strings"
 )
 
 type SimpleTableWriter struct {
@@ -42,6 +43,7 @@ func (t *SimpleTableWriter) Render() string {
 	// Wrap the table.Writer's Render() method to remove trailing spaces.
 	outStr := t.Writer.Render()
 	outStr = reRemoveTrailingSpace.ReplaceAllString(outStr, "\n")
+	outStr = strings.TrimRight(outStr, " ")
 	_, _ = fmt.Fprintln(t.Out, outStr)
 	return outStr
 }
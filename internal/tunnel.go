@@ -0,0 +1,209 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/yuin/gopher-lua"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tunnel is a local port forwarding of a host that "xs tunnel up" starts in the background.
+type Tunnel struct {
+	// Local is the local port with an optional bind address like "5432" or "127.0.0.1:5432".
+	Local string `json:"local" yaml:"local"`
+	// Remote is the destination from the host like "db:5432".
+	Remote string `json:"remote" yaml:"remote"`
+}
+
+// String returns the tunnel in the form of "local -> remote".
+func (t *Tunnel) String() string {
+	return t.Local + " -> " + t.Remote
+}
+
+// forwardSpec returns the argument of the "-L" option of the ssh command.
+func (t *Tunnel) forwardSpec() string {
+	return t.Local + ":" + t.Remote
+}
+
+// dialAddress returns the local address to check whether the tunnel accepts connections.
+func (t *Tunnel) dialAddress() string {
+	host, port, err := net.SplitHostPort(t.Local)
+	if err != nil {
+		// only the port
+		return net.JoinHostPort("localhost", t.Local)
+	}
+	if host == "" || host == "*" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// parseTunnels parses the tunnels parameter. It must be a table of tunnels like
+// `{ { 5432, "db:5432" }, { ["local"] = "127.0.0.1:6379", remote = "cache:6379" } }`.
+// Because "local" is a reserved word of Lua, the keys must be written like ["local"] or the positional form is used.
+func parseTunnels(value lua.LValue) ([]*Tunnel, error) {
+	tb, ok := value.(*lua.LTable)
+	if !ok {
+		return nil, fmt.Errorf("tunnels must be a table but got %s", value.Type().String())
+	}
+	tunnels := make([]*Tunnel, 0)
+	for i := 1; i <= tb.Len(); i++ {
+		ttb, ok := tb.RawGetInt(i).(*lua.LTable)
+		if !ok {
+			return nil, fmt.Errorf("tunnels[%d] must be a table but got %s", i, tb.RawGetInt(i).Type().String())
+		}
+		local := ttb.RawGetString("local")
+		if local == lua.LNil {
+			local = ttb.RawGetInt(1)
+		}
+		remote := ttb.RawGetString("remote")
+		if remote == lua.LNil {
+			remote = ttb.RawGetInt(2)
+		}
+		t := &Tunnel{Local: lua.LVAsString(local), Remote: lua.LVAsString(remote)}
+		if t.Local == "" || t.Remote == "" {
+			return nil, fmt.Errorf("tunnels[%d] must have the local port and the remote address", i)
+		}
+		tunnels = append(tunnels, t)
+	}
+	return tunnels, nil
+}
+
+func newLuaTunnelsTable(L *lua.LState, tunnels []*Tunnel) *lua.LTable {
+	tb := L.NewTable()
+	for _, t := range tunnels {
+		ttb := L.NewTable()
+		if port, err := strconv.Atoi(t.Local); err == nil {
+			ttb.RawSetString("local", lua.LNumber(port))
+		} else {
+			ttb.RawSetString("local", lua.LString(t.Local))
+		}
+		ttb.RawSetString("remote", lua.LString(t.Remote))
+		tb.Append(ttb)
+	}
+	return tb
+}
+
+// tunnelState is the state of the tunnels of a host started by "xs tunnel up".
+// It is stored in ~/.xs/tunnels with the control socket of the ssh process.
+type tunnelState struct {
+	Host      string    `json:"host"`
+	Pid       int       `json:"pid"`
+	Socket    string    `json:"socket"`
+	Tunnels   []*Tunnel `json:"tunnels"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// tunnelID returns the ID of the host used for the file names in the state directory.
+// It is a hash because the host name may have characters that can't be used in file names,
+// and the path of a control socket must be short.
+func tunnelID(host string) string {
+	sum := sha256.Sum256([]byte(host))
+	return hex.EncodeToString(sum[:8])
+}
+
+func tunnelSocketFile(host string) string {
+	return filepath.Join(getTunnelStateDir(), tunnelID(host)+".sock")
+}
+
+func tunnelStateFile(host string) string {
+	return filepath.Join(getTunnelStateDir(), tunnelID(host)+".json")
+}
+
+// readTunnelState returns the state of the host, or nil if the tunnels of the host are not started.
+func readTunnelState(host string) (*tunnelState, error) {
+	return readTunnelStateFile(tunnelStateFile(host))
+}
+
+func readTunnelStateFile(file string) (*tunnelState, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	s := &tunnelState{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	return s, nil
+}
+
+// readAllTunnelStates returns the states of all the hosts sorted by the host names.
+func readAllTunnelStates() ([]*tunnelState, error) {
+	files, err := filepath.Glob(filepath.Join(getTunnelStateDir(), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	states := make([]*tunnelState, 0, len(files))
+	for _, file := range files {
+		s, err := readTunnelStateFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			states = append(states, s)
+		}
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Host < states[j].Host
+	})
+	return states, nil
+}
+
+func writeTunnelState(s *tunnelState) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(tunnelStateFile(s.Host), data, 0600)
+}
+
+// removeTunnelState removes the state file and the control socket of the host.
+func removeTunnelState(host string) {
+	_ = os.Remove(tunnelStateFile(host))
+	_ = os.Remove(tunnelSocketFile(host))
+}
+
+var reMasterPid = regexp.MustCompile(`\(pid=(\d+)\)`)
+
+// parseMasterPid parses the output of "ssh -O check" like "Master running (pid=12345)".
+func parseMasterPid(output string) (int, bool) {
+	m := reMasterPid.FindStringSubmatch(output)
+	if m == nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0, false
+	}
+	return pid, true
+}
+
+// checkTunnel reports whether the local port of the tunnel accepts connections.
+func checkTunnel(t *Tunnel) bool {
+	conn, err := net.DialTimeout("tcp", t.dialAddress(), time.Second)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
+
+func formatTunnels(tunnels []*Tunnel) string {
+	values := make([]string, 0, len(tunnels))
+	for _, t := range tunnels {
+		values = append(values, t.String())
+	}
+	return strings.Join(values, ", ")
+}
@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestParseTunnels(t *testing.T) {
+	L := newLState()
+	defer L.Close()
+
+	err := L.DoString(`
+host_template "db" {
+  tunnels = { { 5432, "db:5432" } },
+}
+
+host "bastion" {
+  extends = "db",
+  tunnels = { { ["local"] = "127.0.0.1:6379", remote = "cache:6379" } },
+}
+
+host.amend("bastion", { tunnels = { { 8080, "web:80" } } })
+assert(host.get("bastion").tunnels[1]["local"] == "127.0.0.1:6379")
+assert(host.get("bastion").tunnels[2]["local"] == 8080)
+`)
+	require.NoError(t, err)
+
+	cfg := getConfigFromLState(L)
+	require.NoError(t, cfg.resolveHostTemplates())
+	h := cfg.NewHostFilter().GetHostByName("bastion")
+	assert.Equal(t, []*Tunnel{
+		{Local: "5432", Remote: "db:5432"},
+		{Local: "127.0.0.1:6379", Remote: "cache:6379"},
+		{Local: "8080", Remote: "web:80"},
+	}, h.Tunnels)
+	assert.Equal(t, "5432 -> db:5432, 127.0.0.1:6379 -> cache:6379, 8080 -> web:80", formatTunnels(h.Tunnels))
+
+	err = L.DoString(`host "web1" { tunnels = { { 5432 } } }`)
+	assert.ErrorContains(t, err, "tunnels[1] must have the local port and the remote address")
+	err = L.DoString(`host "web2" { tunnels = { "5432:db:5432" } }`)
+	assert.ErrorContains(t, err, "tunnels[1] must be a table but got string")
+}
+
+func TestTunnelSSHArgs(t *testing.T) {
+	h := &Host{Name: "bastion", Tunnels: []*Tunnel{{Local: "5432", Remote: "db:5432"}, {Local: "127.0.0.1:6379", Remote: "cache:6379"}}}
+	assert.Equal(t, []string{
+		"-F", "/tmp/ssh_config",
+		"-f", "-N",
+		"-M", "-S", "/tmp/bastion.sock",
+		"-o", "ControlPersist=no",
+		"-o", "ExitOnForwardFailure=yes",
+		"-L", "5432:db:5432",
+		"-L", "127.0.0.1:6379:cache:6379",
+		"bastion",
+	}, tunnelSSHArgs("/tmp/ssh_config", "/tmp/bastion.sock", h))
+}
+
+func TestTunnelDialAddress(t *testing.T) {
+	assert.Equal(t, "localhost:5432", (&Tunnel{Local: "5432"}).dialAddress())
+	assert.Equal(t, "127.0.0.1:5432", (&Tunnel{Local: "127.0.0.1:5432"}).dialAddress())
+	assert.Equal(t, "localhost:5432", (&Tunnel{Local: "*:5432"}).dialAddress())
+	assert.Equal(t, "[::1]:5432", (&Tunnel{Local: "[::1]:5432"}).dialAddress())
+}
+
+func TestParseMasterPid(t *testing.T) {
+	pid, ok := parseMasterPid("Master running (pid=12345)")
+	assert.True(t, ok)
+	assert.Equal(t, 12345, pid)
+	_, ok = parseMasterPid("Control socket connect(/tmp/x.sock): No such file or directory")
+	assert.False(t, ok)
+}
+
+func TestTunnelState(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	s, err := readTunnelState("web1")
+	require.NoError(t, err)
+	assert.Nil(t, s)
+
+	startedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, name := range []string{"web2", "web1"} {
+		require.NoError(t, writeTunnelState(&tunnelState{
+			Host:      name,
+			Pid:       123,
+			Socket:    tunnelSocketFile(name),
+			Tunnels:   []*Tunnel{{Local: "5432", Remote: "db:5432"}},
+			StartedAt: startedAt,
+		}))
+	}
+
+	s, err = readTunnelState("web1")
+	require.NoError(t, err)
+	assert.Equal(t, "web1", s.Host)
+	assert.Equal(t, 123, s.Pid)
+	assert.True(t, startedAt.Equal(s.StartedAt))
+
+	states, err := readAllTunnelStates()
+	require.NoError(t, err)
+	require.Len(t, states, 2)
+	assert.Equal(t, "web1", states[0].Host)
+	assert.Equal(t, "web2", states[1].Host)
+
+	// the ssh process is not running
+	row := tunnelStatusRow(states[0])
+	assert.Equal(t, "dead", row[1])
+	assert.Equal(t, "5432 -> db:5432 (closed)", row[4])
+	assert.Equal(t, "down", tunnelStatusRow(&tunnelState{Host: "web3"})[1])
+
+	removeTunnelState("web1")
+	s, err = readTunnelState("web1")
+	require.NoError(t, err)
+	assert.Nil(t, s)
+}
+
+func TestCheckTunnel(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	assert.True(t, checkTunnel(&Tunnel{Local: addr}))
+	require.NoError(t, l.Close())
+	assert.False(t, checkTunnel(&Tunnel{Local: addr}))
+}
+
+func TestTunnelDown_MasterExited(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ssh command is a shell script")
+	}
+	t.Setenv("HOME", t.TempDir())
+	// The fake ssh command fails like "ssh -O exit" for the master process that has already exited.
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ssh"), []byte("#!/bin/sh\necho 'Control socket connect: No such file or directory' >&2\nexit 255\n"), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// The process that reuses the recorded pid must not be signaled.
+	other := exec.Command("sleep", "30")
+	require.NoError(t, other.Start())
+	exited := make(chan error, 1)
+	go func() { exited <- other.Wait() }()
+	defer func() { _ = other.Process.Kill() }()
+	require.NoError(t, writeTunnelState(&tunnelState{
+		Host:    "web1",
+		Pid:     other.Process.Pid,
+		Socket:  tunnelSocketFile("web1"),
+		Tunnels: []*Tunnel{{Local: "5432", Remote: "db:5432"}},
+	}))
+
+	require.NoError(t, tunnelDown(newTestCommand(), "web1"))
+	select {
+	case err := <-exited:
+		t.Fatalf("the process of the recorded pid was signaled: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	s, err := readTunnelState("web1")
+	require.NoError(t, err)
+	assert.Nil(t, s)
+}